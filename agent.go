@@ -3,12 +3,22 @@ package httpflow
 import (
 	"context"
 	"net/http"
+	"net/url"
+	"time"
 )
 
 var DefaultAgent = &Agent{Client: http.DefaultClient}
 
 type Agent struct {
 	Client HTTPClient
+	// BaseURL is used to resolve the relative URLs of the requests by RFC 3986.
+	// e.g. "users/1" is resolved to "https://example.com/v1/users/1" against "https://example.com/v1/",
+	// but "/users/1" is resolved to "https://example.com/users/1".
+	BaseURL *url.URL
+	// Header is the default header of the requests. It is added unless the session sets the same name.
+	Header      http.Header
+	RetryPolicy *RetryPolicy
+	middlewares []Middleware
 }
 
 func NewAgent(client *http.Client) *Agent {
@@ -24,6 +34,14 @@ type Session interface {
 	ResponseHandler
 }
 
+// RoundTripFunc sends the built request for the session and lets the session handle the response.
+// The returned error is the final error of the round trip, including the one from HandleResponse.
+type RoundTripFunc func(session Session, req *http.Request) (*http.Response, error)
+
+// Middleware wraps a session round trip. Middlewares are applied in the order of Agent.Use,
+// so the first one is the outermost.
+type Middleware func(next RoundTripFunc) RoundTripFunc
+
 type contextSession struct {
 	Session
 	ctx context.Context
@@ -38,20 +56,55 @@ func (s *contextSession) BuildRequest() (*http.Request, error) {
 	return req.WithContext(s.ctx), nil
 }
 
+func (a *Agent) Use(middlewares ...Middleware) {
+	a.middlewares = append(a.middlewares, middlewares...)
+}
+
 func (a *Agent) RunSession(session Session) error {
-	req, err := session.BuildRequest()
-	if err != nil {
-		return err
-	}
+	return a.runSession(session, session)
+}
 
-	res, err := a.Client.Do(req)
-	if err != nil {
-		return err
+func (a *Agent) RunSessionCtx(ctx context.Context, session Session) error {
+	return a.runSession(&contextSession{ctx: ctx, Session: session}, session)
+}
+
+func (a *Agent) runSession(builder RequestBuilder, session Session) error {
+	start := time.Now()
+	for attempt := 1; ; attempt++ {
+		req, err := builder.BuildRequest()
+		if err != nil {
+			return newSessionError(SessionPhaseBuild, nil, attempt, start, err)
+		}
+		a.prepareRequest(req)
+
+		t := &roundTripAttempt{client: a.Client, policy: a.RetryPolicy, attempt: attempt}
+		_, err = a.roundTripper(t.roundTrip)(session, req)
+		if !t.retry {
+			if err != nil {
+				return newSessionError(t.phase(), req, attempt, start, err)
+			}
+			return nil
+		}
+
+		if err := sleepContext(req.Context(), t.wait); err != nil {
+			return newSessionError(SessionPhaseTransport, req, attempt, start, err)
+		}
 	}
+}
 
-	return session.HandleResponse(res)
+func (a *Agent) prepareRequest(req *http.Request) {
+	if a.BaseURL != nil && !req.URL.IsAbs() {
+		req.URL = a.BaseURL.ResolveReference(req.URL)
+		req.Host = req.URL.Host
+	}
+	if a.Header != nil {
+		MergeHeader(req.Header, a.Header, HeaderKeep)
+	}
 }
 
-func (a *Agent) RunSessionCtx(ctx context.Context, session Session) error {
-	return a.RunSession(&contextSession{ctx: ctx, Session: session})
+func (a *Agent) roundTripper(roundTrip RoundTripFunc) RoundTripFunc {
+	for i := len(a.middlewares) - 1; i >= 0; i-- {
+		roundTrip = a.middlewares[i](roundTrip)
+	}
+	return roundTrip
 }
@@ -8,6 +8,8 @@ import (
 	"net/http"
 	"strconv"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 type mockClient struct {
@@ -126,7 +128,7 @@ func TestAgentRunSessionCtx(t *testing.T) {
 		if err == nil {
 			t.Fatal("Should not be nil")
 		}
-		if err.Error() != msg {
+		if err.Error() != "build error (attempt 1): "+msg {
 			t.Error(err)
 		}
 
@@ -152,7 +154,7 @@ func TestAgentRunSessionCtx(t *testing.T) {
 		if err == nil {
 			t.Fatal("Should not be nil")
 		}
-		if err.Error() != msg {
+		if err.Error() != "GET http://example.com/: transport error (attempt 1): "+msg {
 			t.Error(err)
 		}
 
@@ -177,7 +179,7 @@ func TestAgentRunSessionCtx(t *testing.T) {
 		if err == nil {
 			t.Fatal("Should not be nil")
 		}
-		if err.Error() != msg {
+		if err.Error() != "GET http://example.com/: handle error (attempt 1): "+msg {
 			t.Error(err)
 		}
 
@@ -189,3 +191,171 @@ func TestAgentRunSessionCtx(t *testing.T) {
 		}
 	})
 }
+
+func TestAgentUse(t *testing.T) {
+	t.Run("Order", func(t *testing.T) {
+		agent := Agent{Client: mockClient{mockResponse: mockResponse{200, map[string]string{"Content-Type": "text/plain"}, []byte("this is example.com")}}}
+
+		var calls []string
+		newMiddleware := func(name string) Middleware {
+			return func(next RoundTripFunc) RoundTripFunc {
+				return func(session Session, req *http.Request) (*http.Response, error) {
+					calls = append(calls, "before "+name)
+					res, err := next(session, req)
+					calls = append(calls, "after "+name)
+					return res, err
+				}
+			}
+		}
+		agent.Use(newMiddleware("first"), newMiddleware("second"))
+
+		req, err := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		session := &mockSession{request: req}
+		err = agent.RunSession(session)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []string{"before first", "before second", "after second", "after first"}
+		if diff := cmp.Diff(calls, expected); diff != "" {
+			t.Errorf("Should no diff, but got: %s", diff)
+		}
+	})
+
+	t.Run("Observe", func(t *testing.T) {
+		agent := Agent{Client: mockClient{mockResponse: mockResponse{200, map[string]string{"Content-Type": "text/plain"}, []byte("this is example.com")}}}
+
+		const msg = "MOCK RESPONSE ERROR DAYO"
+		var (
+			gotSession  Session
+			gotRequest  *http.Request
+			gotResponse *http.Response
+			gotError    error
+		)
+		agent.Use(func(next RoundTripFunc) RoundTripFunc {
+			return func(session Session, req *http.Request) (*http.Response, error) {
+				req.Header.Set("X-Waiwai", "wai-wai-")
+				res, err := next(session, req)
+				gotSession, gotRequest, gotResponse, gotError = session, req, res, err
+				return res, err
+			}
+		})
+
+		req, err := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		session := &mockSession{request: req, reserr: errors.New(msg)}
+		err = agent.RunSessionCtx(context.Background(), session)
+		if err == nil || errors.Unwrap(err).Error() != msg {
+			t.Errorf("Should be %s, but got: %v", msg, err)
+		}
+
+		if gotSession != session {
+			t.Errorf("Should be same session, but got: %+v", gotSession)
+		}
+		if gotRequest == nil || gotRequest.URL.String() != "http://example.com/" {
+			t.Errorf("Should be built request, but got: %+v", gotRequest)
+		}
+		if gotResponse == nil || gotResponse != session.response {
+			t.Errorf("Should be same response, but got: %+v", gotResponse)
+		}
+		if !errors.Is(err, gotError) {
+			t.Errorf("Should be same error, but got: %v", gotError)
+		}
+		if s := session.response.Request.Header.Get("X-Waiwai"); s != "wai-wai-" {
+			t.Errorf("Should be wai-wai-, but got: %s", s)
+		}
+	})
+
+	t.Run("Short Circuit", func(t *testing.T) {
+		agent := Agent{Client: mockClient{mockResponse: mockResponse{200, map[string]string{"Content-Type": "text/plain"}, []byte("this is example.com")}}}
+
+		const msg = "MOCK MIDDLEWARE ERROR DAYO"
+		agent.Use(func(next RoundTripFunc) RoundTripFunc {
+			return func(session Session, req *http.Request) (*http.Response, error) {
+				return nil, errors.New(msg)
+			}
+		})
+
+		req, err := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		session := &mockSession{request: req}
+		err = agent.RunSession(session)
+		if err == nil || errors.Unwrap(err).Error() != msg {
+			t.Errorf("Should be %s, but got: %v", msg, err)
+		}
+		if session.handleres != 0 {
+			t.Errorf("Should not called, but called %d times", session.handleres)
+		}
+	})
+}
+
+func TestAgentDefaults(t *testing.T) {
+	agent := Agent{
+		Client:  mockClient{mockResponse: mockResponse{statusCode: 200}},
+		BaseURL: mustParseURL("https://api.example.com/v1/"),
+		Header: http.Header{
+			"User-Agent": {"httpflow"},
+			"Accept":     {"application/json"},
+			"x-trace-id": {"abc"},
+		},
+	}
+
+	for name, tc := range map[string]struct {
+		url      string
+		header   http.Header
+		expected string
+		headers  http.Header
+	}{
+		"Relative Path": {"users/1", nil, "https://api.example.com/v1/users/1", http.Header{
+			"User-Agent": {"httpflow"},
+			"Accept":     {"application/json"},
+			"X-Trace-Id": {"abc"},
+		}},
+		"Absolute Path": {"/users/1?page=2", nil, "https://api.example.com/users/1?page=2", nil},
+		"Absolute URL":  {"http://example.com/users/1", nil, "http://example.com/users/1", nil},
+		"Override Header": {"users/1", http.Header{"Accept": {"text/plain", "text/html"}}, "https://api.example.com/v1/users/1", http.Header{
+			"User-Agent": {"httpflow"},
+			"Accept":     {"text/plain", "text/html"},
+			"X-Trace-Id": {"abc"},
+		}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			session := &struct {
+				NobodyRequestBuilder
+				RawResponseHandler
+			}{
+				NobodyRequestBuilder: NobodyRequestBuilder{
+					RequestMethod: http.MethodGet,
+					RequestHeader: tc.header,
+					RequestURL:    mustParseURL(tc.url),
+				},
+			}
+			if err := agent.RunSession(session); err != nil {
+				t.Fatal(err)
+			}
+
+			req := session.RawResponse.Request
+			if s := req.URL.String(); s != tc.expected {
+				t.Errorf("Should be %s, but got: %s", tc.expected, s)
+			}
+			if req.Host != req.URL.Host {
+				t.Errorf("Should be %s, but got: %s", req.URL.Host, req.Host)
+			}
+			if tc.headers != nil {
+				if diff := cmp.Diff(req.Header, tc.headers); diff != "" {
+					t.Errorf("Should no diff, but got: %s", diff)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package httpflow
+
+import (
+	"context"
+	"sync"
+)
+
+type BatchOptions struct {
+	// Concurrency limits the number of sessions running at once. Zero means no limit.
+	Concurrency int
+	// FailFast cancels the rest of the sessions on the first error.
+	// Otherwise all of the sessions are run and their errors are collected.
+	FailFast bool
+}
+
+// RunSessions runs the sessions concurrently and returns their errors in the same order as the sessions.
+// The second return value is a *BatchError if any of the sessions failed.
+func (a *Agent) RunSessions(ctx context.Context, sessions ...Session) ([]error, error) {
+	return a.RunSessionsWithOptions(ctx, BatchOptions{}, sessions...)
+}
+
+func (a *Agent) RunSessionsWithOptions(ctx context.Context, opts BatchOptions, sessions ...Session) ([]error, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 || len(sessions) < concurrency {
+		concurrency = len(sessions)
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	errs := make([]error, len(sessions))
+	semaphore := make(chan struct{}, concurrency)
+	for i, session := range sessions {
+		if err := ctx.Err(); err != nil {
+			errs[i] = err
+			continue
+		}
+
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, session Session) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			err := a.RunSessionCtx(ctx, session)
+			if err == nil {
+				return
+			}
+
+			errs[i] = err
+			mu.Lock()
+			if firstErr == nil {
+				firstErr = err
+			}
+			mu.Unlock()
+
+			if opts.FailFast {
+				cancel()
+			}
+		}(i, session)
+	}
+	wg.Wait()
+
+	if firstErr == nil {
+		for _, err := range errs {
+			if err != nil {
+				firstErr = err
+				break
+			}
+		}
+	}
+	if firstErr != nil {
+		return errs, &BatchError{Err: firstErr, Errors: errs}
+	}
+	return errs, nil
+}
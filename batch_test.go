@@ -0,0 +1,149 @@
+package httpflow
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mockFuncClient func(req *http.Request) (*http.Response, error)
+
+func (f mockFuncClient) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func newBatchTestSessions(t *testing.T, n int) []Session {
+	sessions := make([]Session, n)
+	for i := range sessions {
+		req, err := http.NewRequest(http.MethodGet, "http://example.com/"+strconv.Itoa(i), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions[i] = &mockSession{request: req}
+	}
+	return sessions
+}
+
+func TestAgentRunSessions(t *testing.T) {
+	t.Run("No Error", func(t *testing.T) {
+		agent := Agent{Client: mockFuncClient(func(req *http.Request) (*http.Response, error) {
+			return mockResponse{statusCode: 200}.MockResponse(req), nil
+		})}
+
+		sessions := newBatchTestSessions(t, 10)
+		errs, err := agent.RunSessions(context.Background(), sessions...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(errs) != len(sessions) {
+			t.Fatalf("Should be %d, but got: %d", len(sessions), len(errs))
+		}
+		for i, session := range sessions {
+			if errs[i] != nil {
+				t.Errorf("#%d: Should be nil, but got: %v", i, errs[i])
+			}
+			if s := session.(*mockSession); s.handleres != 1 {
+				t.Errorf("#%d: Should called once, but called %d times", i, s.handleres)
+			}
+		}
+	})
+
+	t.Run("Concurrency", func(t *testing.T) {
+		var (
+			mu          sync.Mutex
+			running     int
+			maxRunnings int
+		)
+		agent := Agent{Client: mockFuncClient(func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			running++
+			if running > maxRunnings {
+				maxRunnings = running
+			}
+			mu.Unlock()
+
+			time.Sleep(time.Millisecond)
+
+			mu.Lock()
+			running--
+			mu.Unlock()
+			return mockResponse{statusCode: 200}.MockResponse(req), nil
+		})}
+
+		sessions := newBatchTestSessions(t, 10)
+		_, err := agent.RunSessionsWithOptions(context.Background(), BatchOptions{Concurrency: 3}, sessions...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if maxRunnings > 3 {
+			t.Errorf("Should be limited to 3, but got: %d", maxRunnings)
+		}
+	})
+
+	t.Run("Collect All", func(t *testing.T) {
+		const msg = "MOCK REQUEST ERROR DAYO"
+		agent := Agent{Client: mockFuncClient(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "/1" || req.URL.Path == "/3" {
+				return nil, errors.New(msg)
+			}
+			return mockResponse{statusCode: 200}.MockResponse(req), nil
+		})}
+
+		sessions := newBatchTestSessions(t, 5)
+		errs, err := agent.RunSessionsWithOptions(context.Background(), BatchOptions{Concurrency: 1}, sessions...)
+		berr, ok := err.(*BatchError)
+		if !ok {
+			t.Fatalf("Should be BatchError, but got: %v", err)
+		}
+		if s := berr.Error(); s != "2 of 5 sessions failed: GET http://example.com/1: transport error (attempt 1): "+msg {
+			t.Errorf("Unexpected error message: %s", s)
+		}
+		for i, err := range errs {
+			if failed := i == 1 || i == 3; failed != (err != nil) {
+				t.Errorf("#%d: Unexpected error: %v", i, err)
+			}
+			if s := sessions[i].(*mockSession); s.buildreq != 1 {
+				t.Errorf("#%d: Should called once, but called %d times", i, s.buildreq)
+			}
+		}
+	})
+
+	t.Run("Fail Fast", func(t *testing.T) {
+		const msg = "MOCK REQUEST ERROR DAYO"
+		agent := Agent{Client: mockFuncClient(func(req *http.Request) (*http.Response, error) {
+			if req.URL.Path == "/0" {
+				return nil, errors.New(msg)
+			}
+			<-req.Context().Done()
+			return nil, req.Context().Err()
+		})}
+
+		sessions := newBatchTestSessions(t, 5)
+		errs, err := agent.RunSessionsWithOptions(context.Background(), BatchOptions{Concurrency: 2, FailFast: true}, sessions...)
+		if err == nil {
+			t.Fatal("Should not be nil")
+		}
+		if berr := err.(*BatchError); errors.Unwrap(berr.Err).Error() != msg {
+			t.Errorf("Should be %s, but got: %v", msg, berr.Err)
+		}
+		if errs[0] == nil || errors.Unwrap(errs[0]).Error() != msg {
+			t.Errorf("Should be %s, but got: %v", msg, errs[0])
+		}
+		for i, err := range errs[1:] {
+			if !errors.Is(err, context.Canceled) {
+				t.Errorf("#%d: Should be context.Canceled, but got: %v", i+1, err)
+			}
+		}
+	})
+
+	t.Run("Empty", func(t *testing.T) {
+		errs, err := DefaultAgent.RunSessions(context.Background())
+		if err != nil || len(errs) != 0 {
+			t.Errorf("Should be empty, but got: %v, %v", errs, err)
+		}
+	})
+}
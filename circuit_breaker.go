@@ -0,0 +1,249 @@
+package httpflow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitOpen
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	default:
+		return fmt.Sprintf("CircuitState(%d)", int(s))
+	}
+}
+
+func SessionTypeKey(session Session, _ *http.Request) string {
+	return fmt.Sprintf("%T", session)
+}
+
+// CircuitBreaker fails sessions fast with CircuitOpenError while the circuit for its key is open.
+// Use it as a middleware: agent.Use(breaker.Middleware)
+type CircuitBreaker struct {
+	// FailureThreshold is the number of consecutive failures to open the circuit. It defaults to 5.
+	FailureThreshold int
+	// OpenTimeout is the duration to keep the circuit open before probing. It defaults to 30 seconds.
+	OpenTimeout time.Duration
+	// HalfOpenProbes is the number of successful probes to close the circuit. It defaults to 1.
+	HalfOpenProbes int
+
+	// Key defaults to HostKey.
+	Key KeyFunc
+	// IsFailure defaults to IsCircuitFailure.
+	IsFailure     func(res *http.Response, err error) bool
+	OnStateChange func(key string, from, to CircuitState)
+
+	mu       sync.Mutex
+	circuits map[string]*circuit
+}
+
+type circuit struct {
+	state CircuitState
+	// generation is incremented on every transition to ignore the results of the requests allowed in the former states.
+	generation uint64
+	failures   int
+	openedAt   time.Time
+	probes     int
+	successes  int
+}
+
+type circuitTransition struct {
+	key      string
+	from, to CircuitState
+}
+
+func IsCircuitFailure(res *http.Response, err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var uerr *UnexpectedStatusCodeError
+	if errors.As(err, &uerr) {
+		return uerr.StatusCode.IsServerError()
+	}
+
+	// made by the other middlewares without reaching the downstream
+	var rerr *RateLimitError
+	var oerr *CircuitOpenError
+	if errors.As(err, &rerr) || errors.As(err, &oerr) {
+		return false
+	}
+	if res == nil {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+func (b *CircuitBreaker) Middleware(next RoundTripFunc) RoundTripFunc {
+	return func(session Session, req *http.Request) (*http.Response, error) {
+		key := b.key(session, req)
+		generation, err := b.allow(key, time.Now())
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := next(session, req)
+		b.record(key, generation, b.isFailure(res, err), time.Now())
+		return res, err
+	}
+}
+
+func (b *CircuitBreaker) State(key string) CircuitState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if c, ok := b.circuits[key]; ok {
+		return c.state
+	}
+	return CircuitClosed
+}
+
+func (b *CircuitBreaker) key(session Session, req *http.Request) string {
+	if b.Key != nil {
+		return b.Key(session, req)
+	}
+	return HostKey(session, req)
+}
+
+func (b *CircuitBreaker) isFailure(res *http.Response, err error) bool {
+	if b.IsFailure != nil {
+		return b.IsFailure(res, err)
+	}
+	return IsCircuitFailure(res, err)
+}
+
+func (b *CircuitBreaker) failureThreshold() int {
+	if b.FailureThreshold <= 0 {
+		return 5
+	}
+	return b.FailureThreshold
+}
+
+func (b *CircuitBreaker) openTimeout() time.Duration {
+	if b.OpenTimeout <= 0 {
+		return 30 * time.Second
+	}
+	return b.OpenTimeout
+}
+
+func (b *CircuitBreaker) halfOpenProbes() int {
+	if b.HalfOpenProbes <= 0 {
+		return 1
+	}
+	return b.HalfOpenProbes
+}
+
+// allow returns the generation of the circuit to pass it to record.
+func (b *CircuitBreaker) allow(key string, now time.Time) (generation uint64, err error) {
+	var transitions []circuitTransition
+	defer func() { b.notify(transitions) }()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuit(key)
+	if c.state == CircuitOpen {
+		if now.Sub(c.openedAt) < b.openTimeout() {
+			return 0, &CircuitOpenError{Key: key, OpenedAt: c.openedAt}
+		}
+		transitions = append(transitions, c.transit(key, CircuitHalfOpen))
+	}
+	if c.state == CircuitHalfOpen {
+		if c.probes+c.successes >= b.halfOpenProbes() {
+			return 0, &CircuitOpenError{Key: key, OpenedAt: c.openedAt}
+		}
+		c.probes++
+	}
+	return c.generation, nil
+}
+
+func (b *CircuitBreaker) record(key string, generation uint64, failure bool, now time.Time) {
+	var transitions []circuitTransition
+	defer func() { b.notify(transitions) }()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	c := b.circuit(key)
+	if c.generation != generation {
+		return
+	}
+
+	switch c.state {
+	case CircuitClosed:
+		if !failure {
+			c.failures = 0
+			return
+		}
+
+		c.failures++
+		if c.failures >= b.failureThreshold() {
+			transitions = append(transitions, c.transit(key, CircuitOpen))
+			c.openedAt = now
+		}
+	case CircuitHalfOpen:
+		c.probes--
+		if failure {
+			transitions = append(transitions, c.transit(key, CircuitOpen))
+			c.openedAt = now
+			return
+		}
+
+		c.successes++
+		if c.successes >= b.halfOpenProbes() {
+			transitions = append(transitions, c.transit(key, CircuitClosed))
+		}
+	}
+}
+
+func (b *CircuitBreaker) circuit(key string) *circuit {
+	if b.circuits == nil {
+		b.circuits = map[string]*circuit{}
+	}
+
+	c, ok := b.circuits[key]
+	if !ok {
+		c = &circuit{state: CircuitClosed}
+		b.circuits[key] = c
+	}
+	return c
+}
+
+func (c *circuit) transit(key string, to CircuitState) circuitTransition {
+	transition := circuitTransition{key: key, from: c.state, to: to}
+	c.state = to
+	c.generation++
+	c.failures = 0
+	c.probes = 0
+	c.successes = 0
+	return transition
+}
+
+func (b *CircuitBreaker) notify(transitions []circuitTransition) {
+	if b.OnStateChange == nil {
+		return
+	}
+	for _, t := range transitions {
+		b.OnStateChange(t.key, t.from, t.to)
+	}
+}
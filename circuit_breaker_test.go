@@ -0,0 +1,233 @@
+package httpflow
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type mockExpectingSession struct {
+	mockSession
+	NobodyResponseHandler
+}
+
+func (m *mockExpectingSession) HandleResponse(res *http.Response) error {
+	m.mockSession.HandleResponse(res)
+	return m.NobodyResponseHandler.HandleResponse(res)
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	t.Run("Trip And Recover", func(t *testing.T) {
+		var transitions []string
+		breaker := &CircuitBreaker{
+			FailureThreshold: 2,
+			OpenTimeout:      10 * time.Millisecond,
+			OnStateChange: func(key string, from, to CircuitState) {
+				transitions = append(transitions, key+": "+from.String()+" -> "+to.String())
+			},
+		}
+		client := &mockSequenceClient{
+			responses: []mockResponse{{statusCode: 500}, {}, {statusCode: 200}},
+			errors:    []error{nil, syscall.ECONNREFUSED},
+		}
+		agent := Agent{Client: client}
+		agent.Use(breaker.Middleware)
+
+		newSession := func() *mockExpectingSession {
+			session := &mockExpectingSession{mockSession: *newRetryTestSession(t)}
+			session.ExpectStatusCode(200)
+			return session
+		}
+
+		if err := agent.RunSession(newSession()); err == nil {
+			t.Fatal("Should not be nil")
+		}
+		if s := breaker.State("example.com"); s != CircuitClosed {
+			t.Errorf("Should be closed, but got: %s", s)
+		}
+		if err := agent.RunSession(newSession()); err == nil {
+			t.Fatal("Should not be nil")
+		}
+		if s := breaker.State("example.com"); s != CircuitOpen {
+			t.Errorf("Should be open, but got: %s", s)
+		}
+
+		session := newSession()
+		err := agent.RunSession(session)
+		var oerr *CircuitOpenError
+		if !errors.As(err, &oerr) || oerr.Key != "example.com" {
+			t.Errorf("Should be CircuitOpenError, but got: %v", err)
+		}
+		if len(client.requests) != 2 {
+			t.Errorf("Should send 2 times, but sent %d times", len(client.requests))
+		}
+		if session.handleres != 0 {
+			t.Errorf("Should not called, but called %d times", session.handleres)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+		if err := agent.RunSession(newSession()); err != nil {
+			t.Fatal(err)
+		}
+		if s := breaker.State("example.com"); s != CircuitClosed {
+			t.Errorf("Should be closed, but got: %s", s)
+		}
+
+		expected := []string{
+			"example.com: closed -> open",
+			"example.com: open -> half-open",
+			"example.com: half-open -> closed",
+		}
+		if diff := cmp.Diff(transitions, expected); diff != "" {
+			t.Errorf("Should no diff, but got: %s", diff)
+		}
+	})
+
+	t.Run("Half Open", func(t *testing.T) {
+		now := time.Now()
+		breaker := &CircuitBreaker{FailureThreshold: 1, OpenTimeout: time.Second}
+
+		breaker.record("example.com", 0, true, now)
+		if _, err := breaker.allow("example.com", now); err == nil {
+			t.Error("Should not be nil")
+		}
+
+		now = now.Add(time.Second)
+		probe, err := breaker.allow("example.com", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := breaker.allow("example.com", now); err == nil {
+			t.Error("Should be limited to one probe")
+		}
+
+		breaker.record("example.com", probe, true, now)
+		if s := breaker.State("example.com"); s != CircuitOpen {
+			t.Errorf("Should be open, but got: %s", s)
+		}
+		if _, err := breaker.allow("example.com", now); err == nil {
+			t.Error("Should not be nil")
+		}
+	})
+
+	t.Run("Stale Result", func(t *testing.T) {
+		now := time.Now()
+		breaker := &CircuitBreaker{FailureThreshold: 1, OpenTimeout: time.Second, HalfOpenProbes: 2}
+
+		slow, err := breaker.allow("example.com", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tripping, err := breaker.allow("example.com", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		breaker.record("example.com", tripping, true, now)
+
+		now = now.Add(time.Second)
+		probe, err := breaker.allow("example.com", now)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the slow request allowed before the trip finishes while half-open
+		breaker.record("example.com", slow, false, now)
+		breaker.record("example.com", slow, false, now)
+		if s := breaker.State("example.com"); s != CircuitHalfOpen {
+			t.Errorf("Should be half-open, but got: %s", s)
+		}
+		if _, err := breaker.allow("example.com", now); err != nil {
+			t.Errorf("Should allow the second probe, but got: %v", err)
+		}
+		if _, err := breaker.allow("example.com", now); err == nil {
+			t.Error("Should be limited to two probes")
+		}
+
+		breaker.record("example.com", probe, false, now)
+		if s := breaker.State("example.com"); s != CircuitHalfOpen {
+			t.Errorf("Should be half-open, but got: %s", s)
+		}
+	})
+
+	t.Run("Success Resets Failures", func(t *testing.T) {
+		now := time.Now()
+		breaker := &CircuitBreaker{FailureThreshold: 2}
+
+		breaker.record("example.com", 0, true, now)
+		breaker.record("example.com", 0, false, now)
+		breaker.record("example.com", 0, true, now)
+		if s := breaker.State("example.com"); s != CircuitClosed {
+			t.Errorf("Should be closed, but got: %s", s)
+		}
+	})
+
+	t.Run("Session Type Key", func(t *testing.T) {
+		breaker := &CircuitBreaker{FailureThreshold: 1, Key: SessionTypeKey}
+		agent := Agent{Client: &mockSequenceClient{errors: []error{syscall.ECONNRESET}}}
+		agent.Use(breaker.Middleware)
+
+		if err := agent.RunSession(newRetryTestSession(t)); err == nil {
+			t.Fatal("Should not be nil")
+		}
+		if s := breaker.State("*httpflow.mockSession"); s != CircuitOpen {
+			t.Errorf("Should be open, but got: %s", s)
+		}
+	})
+}
+
+func TestIsCircuitFailure(t *testing.T) {
+	res := &http.Response{StatusCode: 200}
+	if IsCircuitFailure(res, nil) {
+		t.Error("Should be false")
+	}
+	if !IsCircuitFailure(nil, syscall.ECONNRESET) {
+		t.Error("Should be true")
+	}
+	if IsCircuitFailure(nil, context.Canceled) {
+		t.Error("Should be false")
+	}
+	if !IsCircuitFailure(res, &UnexpectedStatusCodeError{StatusCode: 503}) {
+		t.Error("Should be true")
+	}
+	if IsCircuitFailure(res, &UnexpectedStatusCodeError{StatusCode: 404}) {
+		t.Error("Should be false")
+	}
+	if IsCircuitFailure(res, errors.New("invalid JSON")) {
+		t.Error("Should be false")
+	}
+	if !IsCircuitFailure(res, context.DeadlineExceeded) {
+		t.Error("Should be true")
+	}
+	if IsCircuitFailure(nil, &RateLimitError{Key: "example.com", Err: context.DeadlineExceeded}) {
+		t.Error("Should be false")
+	}
+	if IsCircuitFailure(nil, &CircuitOpenError{Key: "example.com"}) {
+		t.Error("Should be false")
+	}
+}
+
+func TestCircuitBreakerWithRateLimiter(t *testing.T) {
+	breaker := &CircuitBreaker{FailureThreshold: 1}
+	agent := Agent{Client: mockClient{mockResponse: mockResponse{statusCode: 200}}}
+	agent.Use(breaker.Middleware, RateLimitMiddleware(&TokenBucketLimiter{Rate: 0.001, Burst: 1}, nil))
+
+	if err := agent.RunSession(newRetryTestSession(t)); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := agent.RunSessionCtx(ctx, newRetryTestSession(t))
+	var rerr *RateLimitError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("Should be RateLimitError, but got: %v", err)
+	}
+	if s := breaker.State("example.com"); s != CircuitClosed {
+		t.Errorf("Should be closed by the local throttling, but got: %s", s)
+	}
+}
@@ -0,0 +1,437 @@
+package httpflow
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Codec marshals and unmarshals bodies.
+// The library does not depend on any MessagePack or CBOR implementation,
+// so set MessagePackCodec or CBORCodec to use them. e.g.
+//
+//	httpflow.MessagePackCodec = httpflow.CodecFuncs{MarshalFunc: msgpack.Marshal, UnmarshalFunc: msgpack.Unmarshal}
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+type CodecFuncs struct {
+	MarshalFunc   func(v interface{}) ([]byte, error)
+	UnmarshalFunc func(data []byte, v interface{}) error
+}
+
+var _ Codec = CodecFuncs{}
+
+func (c CodecFuncs) Marshal(v interface{}) ([]byte, error) {
+	return c.MarshalFunc(v)
+}
+
+func (c CodecFuncs) Unmarshal(data []byte, v interface{}) error {
+	return c.UnmarshalFunc(data, v)
+}
+
+var (
+	MessagePackCodec Codec
+	CBORCodec        Codec
+)
+
+var ErrNoCodec = errors.New("httpflow: no codec is configured")
+
+var (
+	jsonMediaTypes        = []string{"application/json", "application/json+", "application/+json"}
+	formMediaTypes        = []string{"application/x-www-form-urlencoded"}
+	xmlMediaTypes         = []string{"application/xml", "text/xml", "+xml"}
+	messagePackMediaTypes = []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack", "+msgpack"}
+	cborMediaTypes        = []string{"application/cbor", "+cbor"}
+)
+
+// ParseMediaType returns the lower-cased media type of the Content-Type header without parameters.
+func ParseMediaType(header http.Header) string {
+	return normalizeMediaType(header.Get(contentTypeHeaderName))
+}
+
+func normalizeMediaType(contentType string) string {
+	contentType = strings.TrimSpace(contentType)
+	if mediatype, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mediatype
+	}
+
+	parts := strings.SplitN(contentType, ";", 2)
+	return strings.ToLower(strings.TrimSpace(parts[0]))
+}
+
+// MatchMediaType reports whether the media type matches with any of the patterns.
+// A pattern starting with "+" matches with the structured syntax suffix of any top-level type. e.g. "+xml" matches "image/svg+xml".
+// A pattern like "application/+json" matches with the structured syntax suffix of the top-level type. e.g. "application/+json" matches "application/problem+json" but not "text/foo+json".
+// A pattern ending with "+" matches with the prefix. e.g. "application/json+" matches "application/json+foo".
+func MatchMediaType(mediatype string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if matchMediaTypePattern(mediatype, pattern) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsJSONMediaType reports whether the media type is handled as JSON. e.g. "application/json", "application/problem+json".
+func IsJSONMediaType(mediatype string) bool {
+	return MatchMediaType(mediatype, jsonMediaTypes)
+}
+
+func matchMediaTypePattern(mediatype, pattern string) bool {
+	switch {
+	case strings.HasPrefix(pattern, "+"):
+		return strings.Contains(mediatype, "/") && strings.HasSuffix(mediatype, pattern)
+	case strings.Contains(pattern, "/+"):
+		i := strings.Index(pattern, "/+") + 1
+		return len(mediatype) > len(pattern) && strings.HasPrefix(mediatype, pattern[:i]) && strings.HasSuffix(mediatype, pattern[i:])
+	case strings.HasSuffix(pattern, "+"):
+		return strings.HasPrefix(mediatype, pattern)
+	default:
+		return mediatype == pattern
+	}
+}
+
+// MediaRange is a media range in Accept header.
+type MediaRange struct {
+	MediaType string
+	// Q is the quality value. Nil omits the q parameter, which means 1. Zero means not acceptable.
+	Q *float64
+}
+
+// WithQ returns the media range with the quality value.
+func (r MediaRange) WithQ(q float64) MediaRange {
+	r.Q = &q
+	return r
+}
+
+func (r MediaRange) String() string {
+	if r.Q == nil {
+		return r.MediaType
+	}
+	return r.MediaType + ";q=" + strconv.FormatFloat(*r.Q, 'f', -1, 64)
+}
+
+// FormatAccept formats the media ranges as Accept header value.
+func FormatAccept(ranges ...MediaRange) string {
+	values := make([]string, len(ranges))
+	for i, r := range ranges {
+		values[i] = r.String()
+	}
+	return strings.Join(values, ", ")
+}
+
+type registeredCodec struct {
+	pattern string
+	codec   Codec
+}
+
+// CodecRegistry is a set of codecs keyed by media type. See MatchMediaType for the patterns.
+type CodecRegistry struct {
+	mu     sync.RWMutex
+	codecs []registeredCodec
+}
+
+// NewCodecRegistry returns an empty registry.
+func NewCodecRegistry() *CodecRegistry {
+	return &CodecRegistry{}
+}
+
+// DefaultCodecRegistry has codecs for JSON and XML. Others can be added by RegisterCodec.
+var DefaultCodecRegistry = newDefaultCodecRegistry()
+
+func newDefaultCodecRegistry() *CodecRegistry {
+	r := NewCodecRegistry()
+	jsonCodec := CodecFuncs{MarshalFunc: json.Marshal, UnmarshalFunc: json.Unmarshal}
+	for _, pattern := range jsonMediaTypes {
+		r.Register(pattern, jsonCodec)
+	}
+	xmlCodec := CodecFuncs{MarshalFunc: xml.Marshal, UnmarshalFunc: xml.Unmarshal}
+	for _, pattern := range xmlMediaTypes {
+		r.Register(pattern, xmlCodec)
+	}
+	return r
+}
+
+// RegisterCodec registers the codec to DefaultCodecRegistry.
+func RegisterCodec(pattern string, codec Codec) {
+	DefaultCodecRegistry.Register(pattern, codec)
+}
+
+// Register registers the codec for the media type pattern.
+// It replaces the codec if the pattern is already registered.
+func (r *CodecRegistry) Register(pattern string, codec Codec) {
+	pattern = strings.ToLower(pattern)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i := range r.codecs {
+		if r.codecs[i].pattern == pattern {
+			r.codecs[i].codec = codec
+			return
+		}
+	}
+	r.codecs = append(r.codecs, registeredCodec{pattern: pattern, codec: codec})
+}
+
+// Lookup returns the codec for the media type.
+// An exact match takes precedence over the prefix and suffix patterns.
+func (r *CodecRegistry) Lookup(mediatype string) (Codec, bool) {
+	mediatype = strings.ToLower(mediatype)
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, c := range r.codecs {
+		if c.pattern == mediatype {
+			return c.codec, true
+		}
+	}
+	for _, c := range r.codecs {
+		if matchMediaTypePattern(mediatype, c.pattern) {
+			return c.codec, true
+		}
+	}
+	return nil, false
+}
+
+type CodecRequestBuilder struct {
+	RequestMethod       string
+	RequestHeader       http.Header
+	RequestURL          *url.URL
+	RequestURLTemplate  string
+	RequestURLVariables interface{}
+	RequestQuery        interface{}
+	RequestBody         interface{}
+	// Codec defaults to the codec for ContentType in Registry.
+	Codec       Codec
+	ContentType string
+	// Registry defaults to DefaultCodecRegistry.
+	Registry *CodecRegistry
+	// Accept is set to Accept header unless RequestHeader has it.
+	Accept []MediaRange
+}
+
+var _ RequestBuilder = &CodecRequestBuilder{}
+
+func (r *CodecRequestBuilder) BuildRequest() (*http.Request, error) {
+	var reader io.Reader
+	if r.RequestBody != nil {
+		codec := r.Codec
+		if codec == nil && r.ContentType != "" {
+			registry := r.Registry
+			if registry == nil {
+				registry = DefaultCodecRegistry
+			}
+			codec, _ = registry.Lookup(normalizeMediaType(r.ContentType))
+		}
+		if codec == nil {
+			return nil, ErrNoCodec
+		}
+
+		body, err := codec.Marshal(r.RequestBody)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(body)
+	}
+
+	raw := &RawRequestBuilder{
+		RequestMethod:       r.RequestMethod,
+		RequestHeader:       r.RequestHeader,
+		RequestURL:          r.RequestURL,
+		RequestURLTemplate:  r.RequestURLTemplate,
+		RequestURLVariables: r.RequestURLVariables,
+		RequestQuery:        r.RequestQuery,
+		RequestBody:         reader,
+		DefaultContentType:  r.ContentType,
+		DefaultAccept:       FormatAccept(r.Accept...),
+	}
+	return raw.BuildRequest()
+}
+
+// NegotiatingResponseHandler decodes the body with the codec for Content-Type in Registry.
+type NegotiatingResponseHandler struct {
+	BinaryResponseHandler
+	// Registry defaults to DefaultCodecRegistry.
+	Registry *CodecRegistry
+}
+
+var _ ResponseHandler = &NegotiatingResponseHandler{}
+
+// MediaType returns the media type of the response without parameters.
+func (h *NegotiatingResponseHandler) MediaType() string {
+	return ParseMediaType(h.Header)
+}
+
+func (h *NegotiatingResponseHandler) IsAcceptable() bool {
+	_, ok := h.lookup()
+	return ok
+}
+
+func (h *NegotiatingResponseHandler) Decode(v interface{}) error {
+	codec, ok := h.lookup()
+	if !ok {
+		return &UnexpectedContentTypeError{
+			ContentType: h.Header.Get(contentTypeHeaderName),
+			Body:        h.Bytes(),
+		}
+	}
+	return codec.Unmarshal(h.Bytes(), v)
+}
+
+func (h *NegotiatingResponseHandler) lookup() (Codec, bool) {
+	registry := h.Registry
+	if registry == nil {
+		registry = DefaultCodecRegistry
+	}
+	return registry.Lookup(h.MediaType())
+}
+
+type CodecResponseHandler struct {
+	BinaryResponseHandler
+	Codec Codec
+	// MediaTypes are the acceptable media types. See MatchMediaType for the patterns.
+	MediaTypes []string
+}
+
+var _ ResponseHandler = &CodecResponseHandler{}
+
+func (h *CodecResponseHandler) IsAcceptable() bool {
+	return MatchMediaType(ParseMediaType(h.Header), h.MediaTypes)
+}
+
+func (h *CodecResponseHandler) Decode(v interface{}) error {
+	return h.BinaryResponseHandler.decodeWithCodec(h.Codec, h.MediaTypes, v)
+}
+
+func (h *BinaryResponseHandler) decodeWithCodec(codec Codec, mediaTypes []string, v interface{}) error {
+	if !MatchMediaType(ParseMediaType(h.Header), mediaTypes) {
+		return &UnexpectedContentTypeError{
+			ContentType: h.Header.Get(contentTypeHeaderName),
+			Body:        h.Bytes(),
+		}
+	}
+	if codec == nil {
+		return ErrNoCodec
+	}
+	return codec.Unmarshal(h.Bytes(), v)
+}
+
+type MessagePackRequestBuilder struct {
+	RequestMethod       string
+	RequestHeader       http.Header
+	RequestURL          *url.URL
+	RequestURLTemplate  string
+	RequestURLVariables interface{}
+	RequestQuery        interface{}
+	RequestBody         interface{}
+	// Codec defaults to MessagePackCodec.
+	Codec Codec
+}
+
+var _ RequestBuilder = &MessagePackRequestBuilder{}
+
+func (r *MessagePackRequestBuilder) BuildRequest() (*http.Request, error) {
+	codec := r.Codec
+	if codec == nil {
+		codec = MessagePackCodec
+	}
+
+	builder := &CodecRequestBuilder{
+		RequestMethod:       r.RequestMethod,
+		RequestHeader:       r.RequestHeader,
+		RequestURL:          r.RequestURL,
+		RequestURLTemplate:  r.RequestURLTemplate,
+		RequestURLVariables: r.RequestURLVariables,
+		RequestQuery:        r.RequestQuery,
+		RequestBody:         r.RequestBody,
+		Codec:               codec,
+		ContentType:         "application/msgpack",
+	}
+	return builder.BuildRequest()
+}
+
+type MessagePackResponseHandler struct {
+	BinaryResponseHandler
+	// Codec defaults to MessagePackCodec.
+	Codec Codec
+}
+
+var _ ResponseHandler = &MessagePackResponseHandler{}
+
+func (h *MessagePackResponseHandler) IsMessagePack() bool {
+	return MatchMediaType(ParseMediaType(h.Header), messagePackMediaTypes)
+}
+
+func (h *MessagePackResponseHandler) DecodeMessagePack(v interface{}) error {
+	codec := h.Codec
+	if codec == nil {
+		codec = MessagePackCodec
+	}
+
+	return h.BinaryResponseHandler.decodeWithCodec(codec, messagePackMediaTypes, v)
+}
+
+type CBORRequestBuilder struct {
+	RequestMethod       string
+	RequestHeader       http.Header
+	RequestURL          *url.URL
+	RequestURLTemplate  string
+	RequestURLVariables interface{}
+	RequestQuery        interface{}
+	RequestBody         interface{}
+	// Codec defaults to CBORCodec.
+	Codec Codec
+}
+
+var _ RequestBuilder = &CBORRequestBuilder{}
+
+func (r *CBORRequestBuilder) BuildRequest() (*http.Request, error) {
+	codec := r.Codec
+	if codec == nil {
+		codec = CBORCodec
+	}
+
+	builder := &CodecRequestBuilder{
+		RequestMethod:       r.RequestMethod,
+		RequestHeader:       r.RequestHeader,
+		RequestURL:          r.RequestURL,
+		RequestURLTemplate:  r.RequestURLTemplate,
+		RequestURLVariables: r.RequestURLVariables,
+		RequestQuery:        r.RequestQuery,
+		RequestBody:         r.RequestBody,
+		Codec:               codec,
+		ContentType:         "application/cbor",
+	}
+	return builder.BuildRequest()
+}
+
+type CBORResponseHandler struct {
+	BinaryResponseHandler
+	// Codec defaults to CBORCodec.
+	Codec Codec
+}
+
+var _ ResponseHandler = &CBORResponseHandler{}
+
+func (h *CBORResponseHandler) IsCBOR() bool {
+	return MatchMediaType(ParseMediaType(h.Header), cborMediaTypes)
+}
+
+func (h *CBORResponseHandler) DecodeCBOR(v interface{}) error {
+	codec := h.Codec
+	if codec == nil {
+		codec = CBORCodec
+	}
+
+	return h.BinaryResponseHandler.decodeWithCodec(codec, cborMediaTypes, v)
+}
@@ -0,0 +1,398 @@
+package httpflow
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+var mockJSONCodec = CodecFuncs{MarshalFunc: json.Marshal, UnmarshalFunc: json.Unmarshal}
+
+func TestParseMediaType(t *testing.T) {
+	for contentType, expected := range map[string]string{
+		"application/json":                  "application/json",
+		" Application/JSON ; charset=utf-8": "application/json",
+		"text/plain;":                       "text/plain",
+		"invalid^$#%#@$!@@#&*":              "invalid^$#%#@$!@@#&*",
+		"":                                  "",
+	} {
+		if s := ParseMediaType(http.Header{"Content-Type": {contentType}}); s != expected {
+			t.Errorf("%q: Should be %s, but got: %s", contentType, expected, s)
+		}
+	}
+}
+
+func TestMatchMediaType(t *testing.T) {
+	if !MatchMediaType("application/cbor", cborMediaTypes) {
+		t.Error("Should be true")
+	}
+	if !MatchMediaType("application/senml+cbor", cborMediaTypes) {
+		t.Error("Should be true")
+	}
+	if !MatchMediaType("text/foo+cbor", cborMediaTypes) {
+		t.Error("Should be true")
+	}
+	if MatchMediaType("+cbor", cborMediaTypes) {
+		t.Error("Should be false")
+	}
+	if MatchMediaType("application/json", cborMediaTypes) {
+		t.Error("Should be false")
+	}
+	if !MatchMediaType("application/json+foo", jsonMediaTypes) {
+		t.Error("Should be true")
+	}
+	if !MatchMediaType("application/problem+json", jsonMediaTypes) {
+		t.Error("Should be true")
+	}
+	if MatchMediaType("text/foo+json", jsonMediaTypes) {
+		t.Error("Should be false")
+	}
+	if MatchMediaType("application/+json", jsonMediaTypes) {
+		t.Error("Should be false")
+	}
+}
+
+func TestCodecRequestBuilder(t *testing.T) {
+	url := mustParseURL("http://localhost/")
+	for name, tc := range map[string]struct {
+		builder     func(codec Codec) RequestBuilder
+		contentType string
+	}{
+		"Codec": {func(codec Codec) RequestBuilder {
+			return &CodecRequestBuilder{RequestMethod: http.MethodPost, RequestURL: url, RequestBody: map[string]string{"foo": "bar"}, Codec: codec, ContentType: "application/x-custom"}
+		}, "application/x-custom"},
+		"MessagePack": {func(codec Codec) RequestBuilder {
+			return &MessagePackRequestBuilder{RequestMethod: http.MethodPost, RequestURL: url, RequestBody: map[string]string{"foo": "bar"}, Codec: codec}
+		}, "application/msgpack"},
+		"CBOR": {func(codec Codec) RequestBuilder {
+			return &CBORRequestBuilder{RequestMethod: http.MethodPost, RequestURL: url, RequestBody: map[string]string{"foo": "bar"}, Codec: codec}
+		}, "application/cbor"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req, err := tc.builder(mockJSONCodec).BuildRequest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s := req.Header.Get("Content-Type"); s != tc.contentType {
+				t.Errorf("Should be %s, but got: %s", tc.contentType, s)
+			}
+			if body, err := ioutil.ReadAll(req.Body); string(body) != `{"foo":"bar"}` || err != nil {
+				t.Errorf("Should be {\"foo\":\"bar\"}, but got: %s, error: %v", string(body), err)
+			}
+
+			req, err = tc.builder(nil).BuildRequest()
+			if req != nil {
+				t.Errorf("Should be nil, but got: %v", req)
+			}
+			if err != ErrNoCodec {
+				t.Errorf("Should be ErrNoCodec, but got: %v", err)
+			}
+		})
+	}
+
+	t.Run("Default Codec", func(t *testing.T) {
+		defer func(msgpack, cbor Codec) {
+			MessagePackCodec, CBORCodec = msgpack, cbor
+		}(MessagePackCodec, CBORCodec)
+		MessagePackCodec, CBORCodec = mockJSONCodec, mockJSONCodec
+
+		for _, builder := range []RequestBuilder{
+			&MessagePackRequestBuilder{RequestMethod: http.MethodPost, RequestURL: url, RequestBody: 1},
+			&CBORRequestBuilder{RequestMethod: http.MethodPost, RequestURL: url, RequestBody: 1},
+		} {
+			req, err := builder.BuildRequest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if body, err := ioutil.ReadAll(req.Body); string(body) != `1` || err != nil {
+				t.Errorf("Should be 1, but got: %s, error: %v", string(body), err)
+			}
+		}
+	})
+}
+
+func TestCodecResponseHandler(t *testing.T) {
+	type Body struct {
+		Foo string `json:"foo"`
+	}
+	newResponse := func(contentType string) *http.Response {
+		return &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": {contentType}},
+			Body:       ioutil.NopCloser(strings.NewReader(`{"foo":"bar"}`)),
+		}
+	}
+
+	t.Run("Codec", func(t *testing.T) {
+		handler := &CodecResponseHandler{Codec: mockJSONCodec, MediaTypes: []string{"application/x-custom"}}
+		if err := handler.HandleResponse(newResponse("application/x-custom; charset=utf-8")); err != nil {
+			t.Fatal(err)
+		}
+		if !handler.IsAcceptable() {
+			t.Error("Should be acceptable")
+		}
+
+		var body Body
+		if err := handler.Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Foo != "bar" {
+			t.Errorf("Should get bar, but got: %s", body.Foo)
+		}
+	})
+
+	t.Run("MessagePack", func(t *testing.T) {
+		for _, contentType := range []string{"application/msgpack", "application/x-msgpack", "application/vnd.msgpack", "application/foo+msgpack"} {
+			handler := &MessagePackResponseHandler{Codec: mockJSONCodec}
+			if err := handler.HandleResponse(newResponse(contentType)); err != nil {
+				t.Fatal(err)
+			}
+			if !handler.IsMessagePack() {
+				t.Errorf("%s: Should be detected as msgpack", contentType)
+			}
+
+			var body Body
+			if err := handler.DecodeMessagePack(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Foo != "bar" {
+				t.Errorf("Should get bar, but got: %s", body.Foo)
+			}
+		}
+	})
+
+	t.Run("CBOR", func(t *testing.T) {
+		for _, contentType := range []string{"application/cbor", "application/senml+cbor"} {
+			handler := &CBORResponseHandler{Codec: mockJSONCodec}
+			if err := handler.HandleResponse(newResponse(contentType)); err != nil {
+				t.Fatal(err)
+			}
+			if !handler.IsCBOR() {
+				t.Errorf("%s: Should be detected as cbor", contentType)
+			}
+
+			var body Body
+			if err := handler.DecodeCBOR(&body); err != nil {
+				t.Fatal(err)
+			}
+			if body.Foo != "bar" {
+				t.Errorf("Should get bar, but got: %s", body.Foo)
+			}
+		}
+	})
+
+	t.Run("UnexpectedContentType", func(t *testing.T) {
+		handler := &CBORResponseHandler{Codec: mockJSONCodec}
+		if err := handler.HandleResponse(newResponse("application/json")); err != nil {
+			t.Fatal(err)
+		}
+		if handler.IsCBOR() {
+			t.Error("Should not be detected as cbor")
+		}
+
+		var body Body
+		err := handler.DecodeCBOR(&body)
+		if subErr, ok := err.(*UnexpectedContentTypeError); !ok {
+			t.Error(err)
+		} else if subErr.ContentType != "application/json" {
+			t.Errorf("Should get application/json, but got: %s", subErr.ContentType)
+		} else if string(subErr.Body) != `{"foo":"bar"}` {
+			t.Errorf("Should get {\"foo\":\"bar\"}, but got: %s", string(subErr.Body))
+		}
+	})
+
+	t.Run("No Codec", func(t *testing.T) {
+		handler := &MessagePackResponseHandler{}
+		if err := handler.HandleResponse(newResponse("application/msgpack")); err != nil {
+			t.Fatal(err)
+		}
+
+		var body Body
+		if err := handler.DecodeMessagePack(&body); err != ErrNoCodec {
+			t.Errorf("Should be ErrNoCodec, but got: %v", err)
+		}
+	})
+}
+
+func TestFormatAccept(t *testing.T) {
+	accept := FormatAccept(
+		MediaRange{MediaType: "application/json"},
+		MediaRange{MediaType: "application/xml"}.WithQ(0.5),
+		MediaRange{MediaType: "text/html"}.WithQ(0),
+		MediaRange{MediaType: "*/*"}.WithQ(0.1),
+	)
+	if expected := "application/json, application/xml;q=0.5, text/html;q=0, */*;q=0.1"; accept != expected {
+		t.Errorf("Should be %s, but got: %s", expected, accept)
+	}
+	if accept := FormatAccept(); accept != "" {
+		t.Errorf("Should be empty, but got: %s", accept)
+	}
+}
+
+func TestCodecRegistry(t *testing.T) {
+	exact := CodecFuncs{MarshalFunc: func(interface{}) ([]byte, error) { return []byte("exact"), nil }}
+	suffix := CodecFuncs{MarshalFunc: func(interface{}) ([]byte, error) { return []byte("suffix"), nil }}
+
+	registry := NewCodecRegistry()
+	registry.Register("+yaml", suffix)
+	registry.Register("Application/YAML", exact)
+
+	for mediatype, expected := range map[string]string{
+		"application/yaml":     "exact",
+		"application/foo+yaml": "suffix",
+		"":                     "",
+		"text/yaml":            "",
+	} {
+		codec, ok := registry.Lookup(mediatype)
+		if expected == "" {
+			if ok {
+				t.Errorf("%q: Should not be found", mediatype)
+			}
+			continue
+		}
+		if !ok {
+			t.Errorf("%q: Should be found", mediatype)
+			continue
+		}
+		if b, _ := codec.Marshal(nil); string(b) != expected {
+			t.Errorf("%q: Should be %s, but got: %s", mediatype, expected, string(b))
+		}
+	}
+
+	registry.Register("application/yaml", suffix)
+	codec, _ := registry.Lookup("application/yaml")
+	if b, _ := codec.Marshal(nil); string(b) != "suffix" {
+		t.Errorf("Should be replaced, but got: %s", string(b))
+	}
+
+	for _, mediatype := range []string{"application/json", "application/problem+json", "text/xml", "application/atom+xml"} {
+		if _, ok := DefaultCodecRegistry.Lookup(mediatype); !ok {
+			t.Errorf("%s: Should be registered by default", mediatype)
+		}
+	}
+}
+
+func TestCodecRequestBuilderWithRegistry(t *testing.T) {
+	registry := NewCodecRegistry()
+	registry.Register("application/x-custom", mockJSONCodec)
+
+	builder := &CodecRequestBuilder{
+		RequestMethod: http.MethodPost,
+		RequestURL:    mustParseURL("http://localhost/"),
+		RequestBody:   map[string]string{"foo": "bar"},
+		ContentType:   "application/x-custom; charset=utf-8",
+		Registry:      registry,
+		Accept: []MediaRange{
+			{MediaType: "application/x-custom"},
+			MediaRange{MediaType: "application/json"}.WithQ(0.9),
+		},
+	}
+	req, err := builder.BuildRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if body, err := ioutil.ReadAll(req.Body); string(body) != `{"foo":"bar"}` || err != nil {
+		t.Errorf("Should be {\"foo\":\"bar\"}, but got: %s, error: %v", string(body), err)
+	}
+	if s := req.Header.Get("Accept"); s != "application/x-custom, application/json;q=0.9" {
+		t.Errorf("Should be application/x-custom, application/json;q=0.9, but got: %s", s)
+	}
+
+	builder.RequestHeader = http.Header{"Accept": {"text/plain"}}
+	req, err = builder.BuildRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := req.Header.Get("Accept"); s != "text/plain" {
+		t.Errorf("Should keep text/plain, but got: %s", s)
+	}
+
+	builder.ContentType = "application/x-unknown"
+	if _, err := builder.BuildRequest(); err != ErrNoCodec {
+		t.Errorf("Should be ErrNoCodec, but got: %v", err)
+	}
+}
+
+func TestNegotiatingResponseHandler(t *testing.T) {
+	type Body struct {
+		Foo string `json:"foo" xml:"foo"`
+	}
+	for contentType, body := range map[string]string{
+		"application/json; charset=utf-8": `{"foo":"bar"}`,
+		"application/hal+json":            `{"foo":"bar"}`,
+		"application/xml":                 `<Body><foo>bar</foo></Body>`,
+	} {
+		t.Run(contentType, func(t *testing.T) {
+			handler := &NegotiatingResponseHandler{}
+			err := handler.HandleResponse(&http.Response{
+				StatusCode: 200,
+				Header:     http.Header{"Content-Type": {contentType}},
+				Body:       ioutil.NopCloser(strings.NewReader(body)),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !handler.IsAcceptable() {
+				t.Error("Should be acceptable")
+			}
+
+			var v Body
+			if err := handler.Decode(&v); err != nil {
+				t.Fatal(err)
+			}
+			if v.Foo != "bar" {
+				t.Errorf("Should get bar, but got: %s", v.Foo)
+			}
+		})
+	}
+
+	t.Run("Custom Registry", func(t *testing.T) {
+		registry := NewCodecRegistry()
+		registry.Register("+yaml", mockJSONCodec)
+
+		handler := &NegotiatingResponseHandler{Registry: registry}
+		err := handler.HandleResponse(&http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": {"application/x-foo+yaml"}},
+			Body:       ioutil.NopCloser(strings.NewReader(`{"foo":"bar"}`)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := handler.MediaType(); s != "application/x-foo+yaml" {
+			t.Errorf("Should be application/x-foo+yaml, but got: %s", s)
+		}
+
+		var v Body
+		if err := handler.Decode(&v); err != nil {
+			t.Fatal(err)
+		}
+		if v.Foo != "bar" {
+			t.Errorf("Should get bar, but got: %s", v.Foo)
+		}
+	})
+
+	t.Run("UnexpectedContentType", func(t *testing.T) {
+		handler := &NegotiatingResponseHandler{}
+		err := handler.HandleResponse(&http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": {"text/html"}},
+			Body:       ioutil.NopCloser(strings.NewReader(`<html></html>`)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if handler.IsAcceptable() {
+			t.Error("Should not be acceptable")
+		}
+
+		var v Body
+		if err := handler.Decode(&v); err == nil {
+			t.Error("Should be error")
+		} else if _, ok := err.(*UnexpectedContentTypeError); !ok {
+			t.Errorf("Should be UnexpectedContentTypeError, but got: %v", err)
+		}
+	})
+}
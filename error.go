@@ -1,6 +1,13 @@
 package httpflow
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
 
 type UnexpectedContentTypeError struct {
 	ContentType string
@@ -14,16 +21,89 @@ func (e *UnexpectedContentTypeError) Error() string {
 type UnexpectedStatusCodeError struct {
 	StatusCode
 	Body []byte
+	// Err is the error decoded from Body such as *ProblemError.
+	Err error
 }
 
 func (e *UnexpectedStatusCodeError) Error() (msg string) {
 	msg = fmt.Sprintf("Unexpected StatusCode %d", e.StatusCode)
-	if e.Body != nil {
+	if e.Err != nil {
+		msg += fmt.Sprintf(": %v", e.Err)
+	} else if e.Body != nil {
 		msg += fmt.Sprintf(", Body = %s", truncateString(string(e.Body), 32))
 	}
 	return
 }
 
+func (e *UnexpectedStatusCodeError) Unwrap() error {
+	return e.Err
+}
+
+// SessionPhase is the phase of the session where the error occurred.
+type SessionPhase string
+
+const (
+	SessionPhaseBuild     SessionPhase = "build"
+	SessionPhaseTransport SessionPhase = "transport"
+	SessionPhaseHandle    SessionPhase = "handle"
+)
+
+// SessionError is the error returned from Agent.RunSession with the context of the request.
+type SessionError struct {
+	Method string
+	// URL has the password and the query values redacted. It is empty if the request is not built.
+	URL     string
+	Phase   SessionPhase
+	Attempt int
+	Elapsed time.Duration
+	Err     error
+}
+
+func newSessionError(phase SessionPhase, req *http.Request, attempt int, start time.Time, err error) *SessionError {
+	e := &SessionError{Phase: phase, Attempt: attempt, Elapsed: time.Since(start), Err: err}
+	if req != nil {
+		e.Method = req.Method
+		e.URL = redactURL(req.URL)
+	}
+
+	// *url.Error from http.Client has the raw URL, which may be the URL redirected to.
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		if u, perr := url.Parse(urlErr.URL); perr == nil {
+			urlErr.URL = redactURL(u)
+		} else {
+			urlErr.URL = e.URL
+		}
+	}
+	return e
+}
+
+// redactURL redacts the query values in addition to url.URL.Redacted since they may have credentials such as access_token.
+func redactURL(u *url.URL) string {
+	redacted := *u
+	if redacted.RawQuery != "" {
+		query := redacted.Query()
+		for _, values := range query {
+			for i := range values {
+				values[i] = "xxxxx"
+			}
+		}
+		redacted.RawQuery = query.Encode()
+	}
+	return redacted.Redacted()
+}
+
+func (e *SessionError) Error() string {
+	if e.URL == "" {
+		return fmt.Sprintf("%s error (attempt %d): %v", e.Phase, e.Attempt, e.Err)
+	}
+	return fmt.Sprintf("%s %s: %s error (attempt %d): %v", e.Method, e.URL, e.Phase, e.Attempt, e.Err)
+}
+
+func (e *SessionError) Unwrap() error {
+	return e.Err
+}
+
 func truncateString(str string, num int) string {
 	bnoden := str
 	if len(str) > num {
@@ -34,3 +114,104 @@ func truncateString(str string, num int) string {
 	}
 	return bnoden
 }
+
+type RateLimitError struct {
+	Key string
+	Err error
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("Rate limit exceeded for %s: %v", e.Key, e.Err)
+}
+
+func (e *RateLimitError) Unwrap() error {
+	return e.Err
+}
+
+type CircuitOpenError struct {
+	Key      string
+	OpenedAt time.Time
+}
+
+func (e *CircuitOpenError) Error() string {
+	return fmt.Sprintf("Circuit open for %s", e.Key)
+}
+
+type BatchError struct {
+	// Err is the first error that occurred.
+	Err error
+	// Errors are the errors of each session in the same order as the sessions.
+	Errors []error
+}
+
+func (e *BatchError) Error() string {
+	failed := 0
+	for _, err := range e.Errors {
+		if err != nil {
+			failed++
+		}
+	}
+	return fmt.Sprintf("%d of %d sessions failed: %v", failed, len(e.Errors), e.Err)
+}
+
+func (e *BatchError) Unwrap() error {
+	return e.Err
+}
+
+type FlowStepError struct {
+	Step string
+	Err  error
+}
+
+func (e *FlowStepError) Error() string {
+	return fmt.Sprintf("Flow step %s failed: %v", e.Step, e.Err)
+}
+
+func (e *FlowStepError) Unwrap() error {
+	return e.Err
+}
+
+type GraphError struct {
+	// Failed are the names of the failed nodes.
+	Failed []string
+	// Errors are the errors of the failed and canceled nodes by their names.
+	Errors map[string]error
+}
+
+func (e *GraphError) Error() string {
+	msgs := make([]string, len(e.Failed))
+	for i, name := range e.Failed {
+		msgs[i] = fmt.Sprintf("%s: %v", name, e.Errors[name])
+	}
+	return fmt.Sprintf("Graph node failed: %s", strings.Join(msgs, ", "))
+}
+
+func (e *GraphError) Unwrap() error {
+	if len(e.Failed) == 0 {
+		return nil
+	}
+	return e.Errors[e.Failed[0]]
+}
+
+type CompensationError struct {
+	// Err is the original failure of the flow.
+	Err error
+	// CompensationErrors are the failures of the compensations.
+	CompensationErrors []error
+}
+
+func (e *CompensationError) Error() string {
+	if len(e.CompensationErrors) == 0 {
+		return fmt.Sprintf("%v (compensated)", e.Err)
+	}
+
+	msgs := make([]string, len(e.CompensationErrors))
+	for i, err := range e.CompensationErrors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%v (compensation failed: %s)", e.Err, strings.Join(msgs, ", "))
+}
+
+func (e *CompensationError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,162 @@
+package httpflow
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// FlowEnd is the step name to finish the flow without running the rest of the steps.
+const FlowEnd = "$end"
+
+// FlowResults holds the sessions of the finished steps by their names.
+type FlowResults map[string]Session
+
+type FlowStep struct {
+	Name string
+	// Session builds the session of the step from the results of the previous steps.
+	Session func(results FlowResults) (Session, error)
+	// If skips the step when it returns false.
+	If func(results FlowResults) bool
+	// Next returns the name of the step to run next. Empty means the following step.
+	Next func(results FlowResults) string
+	// Compensate builds the session to undo the step.
+	// When a later step fails, the compensations of the finished steps are run in reverse order.
+	Compensate func(results FlowResults) (Session, error)
+}
+
+// Flow is a sequence of sessions which can feed each other.
+type Flow struct {
+	Steps []FlowStep
+}
+
+func NewFlow(steps ...FlowStep) *Flow {
+	return &Flow{Steps: steps}
+}
+
+func (f *Flow) AddStep(step FlowStep) {
+	f.Steps = append(f.Steps, step)
+}
+
+func (f *Flow) indexSteps() (map[string]int, error) {
+	index := make(map[string]int, len(f.Steps))
+	for i, step := range f.Steps {
+		if step.Name == "" || step.Name == FlowEnd {
+			return nil, fmt.Errorf("invalid flow step name: %q", step.Name)
+		}
+		if _, ok := index[step.Name]; ok {
+			return nil, fmt.Errorf("duplicated flow step name: %q", step.Name)
+		}
+		if step.Session == nil {
+			return nil, fmt.Errorf("flow step %q has no session", step.Name)
+		}
+		index[step.Name] = i
+	}
+	return index, nil
+}
+
+// RunFlow runs the steps of the flow in order under the context.
+// The returned error is a *FlowStepError which tells the failed step,
+// or a *CompensationError if any compensation has been run for the failure.
+func (a *Agent) RunFlow(ctx context.Context, flow *Flow) (FlowResults, error) {
+	index, err := flow.indexSteps()
+	if err != nil {
+		return nil, err
+	}
+
+	results := FlowResults{}
+	finished, err := a.runFlowSteps(ctx, flow, index, results)
+	if err != nil {
+		return results, a.compensateFlow(ctx, finished, results, err)
+	}
+	return results, nil
+}
+
+func (a *Agent) runFlowSteps(ctx context.Context, flow *Flow, index map[string]int, results FlowResults) (finished []FlowStep, err error) {
+	for i := 0; i < len(flow.Steps); {
+		step := flow.Steps[i]
+		if err := ctx.Err(); err != nil {
+			return finished, &FlowStepError{Step: step.Name, Err: err}
+		}
+		if step.If != nil && !step.If(results) {
+			i++
+			continue
+		}
+
+		session, err := step.Session(results)
+		if err != nil {
+			return finished, &FlowStepError{Step: step.Name, Err: err}
+		}
+		if err := a.RunSessionCtx(ctx, session); err != nil {
+			return finished, &FlowStepError{Step: step.Name, Err: err}
+		}
+		results[step.Name] = session
+		finished = append(finished, step)
+
+		next := ""
+		if step.Next != nil {
+			next = step.Next(results)
+		}
+		switch next {
+		case "":
+			i++
+		case FlowEnd:
+			return finished, nil
+		default:
+			j, ok := index[next]
+			if !ok {
+				return finished, &FlowStepError{Step: step.Name, Err: fmt.Errorf("unknown next flow step: %q", next)}
+			}
+			i = j
+		}
+	}
+	return finished, nil
+}
+
+func (a *Agent) compensateFlow(ctx context.Context, finished []FlowStep, results FlowResults, cause error) error {
+	// compensations should be run even if the flow has been canceled
+	ctx = detachedContext{ctx}
+
+	compensated := false
+	var errs []error
+	for i := len(finished) - 1; i >= 0; i-- {
+		step := finished[i]
+		if step.Compensate == nil {
+			continue
+		}
+		compensated = true
+
+		session, err := step.Compensate(results)
+		if err == nil {
+			err = a.RunSessionCtx(ctx, session)
+		}
+		if err != nil {
+			errs = append(errs, &FlowStepError{Step: step.Name, Err: err})
+		}
+	}
+
+	if !compensated {
+		return cause
+	}
+	return &CompensationError{Err: cause, CompensationErrors: errs}
+}
+
+type detachedContext struct {
+	parent context.Context
+}
+
+func (c detachedContext) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (c detachedContext) Done() <-chan struct{} {
+	return nil
+}
+
+func (c detachedContext) Err() error {
+	return nil
+}
+
+func (c detachedContext) Value(key interface{}) interface{} {
+	return c.parent.Value(key)
+}
@@ -0,0 +1,329 @@
+package httpflow
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type mockFlowSession struct {
+	NobodyRequestBuilder
+	JSONResponseHandler
+}
+
+func newMockFlowSession(path string, token string) *mockFlowSession {
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	return &mockFlowSession{
+		NobodyRequestBuilder: NobodyRequestBuilder{
+			RequestMethod: http.MethodGet,
+			RequestHeader: header,
+			RequestURL:    mustParseURL("http://example.com" + path),
+		},
+	}
+}
+
+func newMockFlowAgent(paths *[]string) *Agent {
+	return &Agent{Client: mockFuncClient(func(req *http.Request) (*http.Response, error) {
+		*paths = append(*paths, req.URL.Path)
+		switch req.URL.Path {
+		case "/login":
+			return mockResponse{200, map[string]string{"Content-Type": "application/json"}, []byte(`{"token":"t0k3n"}`)}.MockResponse(req), nil
+		case "/error":
+			return nil, errors.New("MOCK REQUEST ERROR DAYO")
+		default:
+			body := `{"authorization":"` + req.Header.Get("Authorization") + `"}`
+			return mockResponse{200, map[string]string{"Content-Type": "application/json"}, []byte(body)}.MockResponse(req), nil
+		}
+	})}
+}
+
+func loginToken(results FlowResults) (string, error) {
+	var body struct {
+		Token string `json:"token"`
+	}
+	if err := results["login"].(*mockFlowSession).DecodeJSON(&body); err != nil {
+		return "", err
+	}
+	return body.Token, nil
+}
+
+func TestAgentRunFlow(t *testing.T) {
+	t.Run("Chain", func(t *testing.T) {
+		var paths []string
+		agent := newMockFlowAgent(&paths)
+
+		flow := NewFlow(FlowStep{
+			Name: "login",
+			Session: func(_ FlowResults) (Session, error) {
+				return newMockFlowSession("/login", ""), nil
+			},
+		})
+		flow.AddStep(FlowStep{
+			Name: "users",
+			Session: func(results FlowResults) (Session, error) {
+				token, err := loginToken(results)
+				if err != nil {
+					return nil, err
+				}
+				return newMockFlowSession("/users", token), nil
+			},
+		})
+
+		results, err := agent.RunFlow(context.Background(), flow)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(paths, []string{"/login", "/users"}); diff != "" {
+			t.Errorf("Should no diff, but got: %s", diff)
+		}
+
+		var body struct {
+			Authorization string `json:"authorization"`
+		}
+		if err := results["users"].(*mockFlowSession).DecodeJSON(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Authorization != "Bearer t0k3n" {
+			t.Errorf("Should be Bearer t0k3n, but got: %s", body.Authorization)
+		}
+	})
+
+	t.Run("Branch", func(t *testing.T) {
+		var paths []string
+		agent := newMockFlowAgent(&paths)
+
+		newStep := func(name string) FlowStep {
+			return FlowStep{
+				Name: name,
+				Session: func(_ FlowResults) (Session, error) {
+					return newMockFlowSession("/"+name, ""), nil
+				},
+			}
+		}
+
+		login := newStep("login")
+		login.Next = func(results FlowResults) string {
+			if _, ok := results["login"]; ok {
+				return "admin"
+			}
+			return ""
+		}
+		users := newStep("users")
+		admin := newStep("admin")
+		admin.Next = func(_ FlowResults) string {
+			return FlowEnd
+		}
+		skipped := newStep("skipped")
+		skipped.If = func(_ FlowResults) bool {
+			return false
+		}
+
+		results, err := agent.RunFlow(context.Background(), NewFlow(skipped, login, users, admin, newStep("never")))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(paths, []string{"/login", "/admin"}); diff != "" {
+			t.Errorf("Should no diff, but got: %s", diff)
+		}
+		if len(results) != 2 {
+			t.Errorf("Should have 2 results, but got: %d", len(results))
+		}
+	})
+
+	t.Run("Step Error", func(t *testing.T) {
+		var paths []string
+		agent := newMockFlowAgent(&paths)
+
+		flow := NewFlow(
+			FlowStep{Name: "login", Session: func(_ FlowResults) (Session, error) {
+				return newMockFlowSession("/login", ""), nil
+			}},
+			FlowStep{Name: "fetch", Session: func(_ FlowResults) (Session, error) {
+				return newMockFlowSession("/error", ""), nil
+			}},
+			FlowStep{Name: "never", Session: func(_ FlowResults) (Session, error) {
+				return newMockFlowSession("/never", ""), nil
+			}},
+		)
+
+		results, err := agent.RunFlow(context.Background(), flow)
+		serr, ok := err.(*FlowStepError)
+		if !ok {
+			t.Fatalf("Should be FlowStepError, but got: %v", err)
+		}
+		if serr.Step != "fetch" {
+			t.Errorf("Should be fetch, but got: %s", serr.Step)
+		}
+		if _, ok := results["login"]; !ok {
+			t.Error("Should have the result of login")
+		}
+		if diff := cmp.Diff(paths, []string{"/login", "/error"}); diff != "" {
+			t.Errorf("Should no diff, but got: %s", diff)
+		}
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		var paths []string
+		agent := newMockFlowAgent(&paths)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		flow := NewFlow(
+			FlowStep{Name: "login", Session: func(_ FlowResults) (Session, error) {
+				return newMockFlowSession("/login", ""), nil
+			}},
+		)
+
+		_, err := agent.RunFlow(ctx, flow)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Should be context.Canceled, but got: %v", err)
+		}
+		if len(paths) != 0 {
+			t.Errorf("Should not send, but sent: %v", paths)
+		}
+	})
+
+	t.Run("Invalid Flow", func(t *testing.T) {
+		session := func(_ FlowResults) (Session, error) {
+			return newMockFlowSession("/", ""), nil
+		}
+		for _, flow := range []*Flow{
+			NewFlow(FlowStep{Session: session}),
+			NewFlow(FlowStep{Name: "a", Session: session}, FlowStep{Name: "a", Session: session}),
+			NewFlow(FlowStep{Name: "a"}),
+		} {
+			if _, err := DefaultAgent.RunFlow(context.Background(), flow); err == nil {
+				t.Error("Should not be nil")
+			}
+		}
+
+		var paths []string
+		agent := newMockFlowAgent(&paths)
+		_, err := agent.RunFlow(context.Background(), NewFlow(FlowStep{
+			Name:    "a",
+			Session: session,
+			Next: func(_ FlowResults) string {
+				return "unknown"
+			},
+		}))
+		if serr, ok := err.(*FlowStepError); !ok || serr.Step != "a" {
+			t.Errorf("Should be FlowStepError, but got: %v", err)
+		}
+	})
+}
+
+func TestAgentRunFlowCompensation(t *testing.T) {
+	newStep := func(name, path, compensationPath string) FlowStep {
+		step := FlowStep{
+			Name: name,
+			Session: func(_ FlowResults) (Session, error) {
+				return newMockFlowSession(path, ""), nil
+			},
+		}
+		if compensationPath != "" {
+			step.Compensate = func(results FlowResults) (Session, error) {
+				if _, ok := results[name]; !ok {
+					t.Errorf("Should have the result of %s", name)
+				}
+				return newMockFlowSession(compensationPath, ""), nil
+			}
+		}
+		return step
+	}
+
+	t.Run("Compensated", func(t *testing.T) {
+		var paths []string
+		agent := newMockFlowAgent(&paths)
+
+		flow := NewFlow(
+			newStep("order", "/order", "/order/cancel"),
+			newStep("log", "/log", ""),
+			newStep("stock", "/stock", "/stock/release"),
+			newStep("charge", "/error", "/charge/refund"),
+		)
+		_, err := agent.RunFlow(context.Background(), flow)
+		cerr, ok := err.(*CompensationError)
+		if !ok {
+			t.Fatalf("Should be CompensationError, but got: %v", err)
+		}
+		if len(cerr.CompensationErrors) != 0 {
+			t.Errorf("Should be empty, but got: %v", cerr.CompensationErrors)
+		}
+
+		var serr *FlowStepError
+		if !errors.As(err, &serr) || serr.Step != "charge" {
+			t.Errorf("Should be FlowStepError of charge, but got: %v", err)
+		}
+
+		expected := []string{"/order", "/log", "/stock", "/error", "/stock/release", "/order/cancel"}
+		if diff := cmp.Diff(paths, expected); diff != "" {
+			t.Errorf("Should no diff, but got: %s", diff)
+		}
+	})
+
+	t.Run("Compensation Failed", func(t *testing.T) {
+		var paths []string
+		agent := newMockFlowAgent(&paths)
+
+		flow := NewFlow(
+			newStep("order", "/order", "/order/cancel"),
+			newStep("stock", "/stock", "/error"),
+			newStep("charge", "/error", "/charge/refund"),
+		)
+		_, err := agent.RunFlow(context.Background(), flow)
+		cerr, ok := err.(*CompensationError)
+		if !ok {
+			t.Fatalf("Should be CompensationError, but got: %v", err)
+		}
+		if len(cerr.CompensationErrors) != 1 {
+			t.Fatalf("Should have 1 error, but got: %v", cerr.CompensationErrors)
+		}
+		if serr, ok := cerr.CompensationErrors[0].(*FlowStepError); !ok || serr.Step != "stock" {
+			t.Errorf("Should be FlowStepError of stock, but got: %v", cerr.CompensationErrors[0])
+		}
+
+		expected := []string{"/order", "/stock", "/error", "/error", "/order/cancel"}
+		if diff := cmp.Diff(paths, expected); diff != "" {
+			t.Errorf("Should no diff, but got: %s", diff)
+		}
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		var paths []string
+		agent := newMockFlowAgent(&paths)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		order := newStep("order", "/order", "/order/cancel")
+		order.Next = func(_ FlowResults) string {
+			cancel()
+			return ""
+		}
+		_, err := agent.RunFlow(ctx, NewFlow(order, newStep("stock", "/stock", "")))
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Should be context.Canceled, but got: %v", err)
+		}
+
+		expected := []string{"/order", "/order/cancel"}
+		if diff := cmp.Diff(paths, expected); diff != "" {
+			t.Errorf("Should no diff, but got: %s", diff)
+		}
+	})
+
+	t.Run("No Compensation", func(t *testing.T) {
+		var paths []string
+		agent := newMockFlowAgent(&paths)
+
+		_, err := agent.RunFlow(context.Background(), NewFlow(newStep("order", "/order", ""), newStep("charge", "/error", "")))
+		if _, ok := err.(*FlowStepError); !ok {
+			t.Errorf("Should be FlowStepError, but got: %v", err)
+		}
+	})
+}
@@ -0,0 +1,9 @@
+module github.com/karupanerura/go-httpflow
+
+go 1.18
+
+require (
+	github.com/google/go-cmp v0.6.0
+	golang.org/x/text v0.22.0
+	google.golang.org/protobuf v1.34.1
+)
@@ -0,0 +1,250 @@
+package httpflow
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type NodeStatus int
+
+const (
+	NodePending NodeStatus = iota
+	NodeSucceeded
+	NodeFailed
+	NodeCanceled
+)
+
+func (s NodeStatus) String() string {
+	switch s {
+	case NodePending:
+		return "pending"
+	case NodeSucceeded:
+		return "succeeded"
+	case NodeFailed:
+		return "failed"
+	case NodeCanceled:
+		return "canceled"
+	default:
+		return fmt.Sprintf("NodeStatus(%d)", int(s))
+	}
+}
+
+type GraphNode struct {
+	Name      string
+	DependsOn []string
+	// Session builds the session of the node from the results of its dependencies.
+	Session func(results FlowResults) (Session, error)
+}
+
+// Graph is a DAG of sessions. Independent nodes are run in parallel.
+type Graph struct {
+	Nodes []GraphNode
+}
+
+func NewGraph(nodes ...GraphNode) *Graph {
+	return &Graph{Nodes: nodes}
+}
+
+func (g *Graph) AddNode(node GraphNode) {
+	g.Nodes = append(g.Nodes, node)
+}
+
+// Validate checks the names and dependencies of the nodes, and detects cycles.
+func (g *Graph) Validate() error {
+	index := make(map[string]int, len(g.Nodes))
+	for i, node := range g.Nodes {
+		if node.Name == "" {
+			return fmt.Errorf("invalid graph node name: %q", node.Name)
+		}
+		if _, ok := index[node.Name]; ok {
+			return fmt.Errorf("duplicated graph node name: %q", node.Name)
+		}
+		if node.Session == nil {
+			return fmt.Errorf("graph node %q has no session", node.Name)
+		}
+		index[node.Name] = i
+	}
+	for _, node := range g.Nodes {
+		for _, dep := range node.DependsOn {
+			if _, ok := index[dep]; !ok {
+				return fmt.Errorf("graph node %q depends on unknown node: %q", node.Name, dep)
+			}
+		}
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	marks := make([]int, len(g.Nodes))
+	var path []string
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch marks[i] {
+		case visiting:
+			start := 0
+			for j, name := range path {
+				if name == g.Nodes[i].Name {
+					start = j
+				}
+			}
+			cycle := append(path[start:], g.Nodes[i].Name)
+			return fmt.Errorf("graph has a cycle: %s", strings.Join(cycle, " -> "))
+		case visited:
+			return nil
+		}
+
+		marks[i] = visiting
+		path = append(path, g.Nodes[i].Name)
+		for _, dep := range g.Nodes[i].DependsOn {
+			if err := visit(index[dep]); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		marks[i] = visited
+		return nil
+	}
+	for i := range g.Nodes {
+		if err := visit(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type GraphResult struct {
+	Results  FlowResults
+	Statuses map[string]NodeStatus
+	Errors   map[string]error
+}
+
+// RunGraph runs the nodes of the graph in topological order with maximum parallelism.
+// When a node fails, the nodes depending on it are canceled and the error is a *GraphError.
+// When the context is done, the nodes not started yet are canceled and the error is the context's error unless a node failed.
+func (a *Agent) RunGraph(ctx context.Context, graph *Graph) (*GraphResult, error) {
+	if err := graph.Validate(); err != nil {
+		return nil, err
+	}
+
+	result := &GraphResult{
+		Results:  FlowResults{},
+		Statuses: make(map[string]NodeStatus, len(graph.Nodes)),
+		Errors:   map[string]error{},
+	}
+	dependents := map[string][]int{}
+	remaining := make([]int, len(graph.Nodes))
+	for i, node := range graph.Nodes {
+		result.Statuses[node.Name] = NodePending
+		remaining[i] = len(node.DependsOn)
+		for _, dep := range node.DependsOn {
+			dependents[dep] = append(dependents[dep], i)
+		}
+	}
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		run  func(i int)
+		done func(i int, err error)
+	)
+	cancelDependents := func(name string, cause func(name string) error) {
+		queue := []string{name}
+		for len(queue) > 0 {
+			name, queue = queue[0], queue[1:]
+			for _, j := range dependents[name] {
+				dep := graph.Nodes[j].Name
+				if result.Statuses[dep] != NodePending {
+					continue
+				}
+				result.Statuses[dep] = NodeCanceled
+				result.Errors[dep] = cause(name)
+				queue = append(queue, dep)
+			}
+		}
+	}
+	canceledByFailure := func(name string) error {
+		return fmt.Errorf("canceled by the failure of %q", name)
+	}
+	done = func(i int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		node := graph.Nodes[i]
+		if err != nil {
+			result.Statuses[node.Name] = NodeFailed
+			result.Errors[node.Name] = err
+			cancelDependents(node.Name, canceledByFailure)
+			return
+		}
+
+		result.Statuses[node.Name] = NodeSucceeded
+		for _, j := range dependents[node.Name] {
+			remaining[j]--
+			if remaining[j] == 0 && result.Statuses[graph.Nodes[j].Name] == NodePending {
+				wg.Add(1)
+				go run(j)
+			}
+		}
+	}
+	run = func(i int) {
+		defer wg.Done()
+
+		node := graph.Nodes[i]
+		if err := ctx.Err(); err != nil {
+			mu.Lock()
+			result.Statuses[node.Name] = NodeCanceled
+			result.Errors[node.Name] = err
+			cancelDependents(node.Name, func(string) error { return err })
+			mu.Unlock()
+			return
+		}
+
+		mu.Lock()
+		results := make(FlowResults, len(node.DependsOn))
+		for _, dep := range node.DependsOn {
+			results[dep] = result.Results[dep]
+		}
+		mu.Unlock()
+
+		session, err := node.Session(results)
+		if err == nil {
+			err = a.RunSessionCtx(ctx, session)
+		}
+		if err == nil {
+			mu.Lock()
+			result.Results[node.Name] = session
+			mu.Unlock()
+		}
+		done(i, err)
+	}
+
+	mu.Lock()
+	for i := range graph.Nodes {
+		if remaining[i] == 0 {
+			wg.Add(1)
+			go run(i)
+		}
+	}
+	mu.Unlock()
+	wg.Wait()
+
+	var failed []string
+	for name, status := range result.Statuses {
+		if status == NodeFailed {
+			failed = append(failed, name)
+		}
+	}
+	if len(failed) != 0 {
+		sort.Strings(failed)
+		return result, &GraphError{Failed: failed, Errors: result.Errors}
+	}
+	if err := ctx.Err(); err != nil && len(result.Errors) != 0 {
+		return result, err
+	}
+	return result, nil
+}
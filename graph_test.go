@@ -0,0 +1,216 @@
+package httpflow
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func newMockGraphNode(name string, deps ...string) GraphNode {
+	return GraphNode{
+		Name:      name,
+		DependsOn: deps,
+		Session: func(_ FlowResults) (Session, error) {
+			return newMockFlowSession("/"+name, ""), nil
+		},
+	}
+}
+
+func TestGraphValidate(t *testing.T) {
+	for name, tc := range map[string]struct {
+		graph *Graph
+		err   string
+	}{
+		"Valid":        {NewGraph(newMockGraphNode("a"), newMockGraphNode("b", "a"), newMockGraphNode("c", "a", "b")), ""},
+		"Empty Name":   {NewGraph(newMockGraphNode("")), `invalid graph node name: ""`},
+		"Duplicated":   {NewGraph(newMockGraphNode("a"), newMockGraphNode("a")), `duplicated graph node name: "a"`},
+		"No Session":   {NewGraph(GraphNode{Name: "a"}), `graph node "a" has no session`},
+		"Unknown":      {NewGraph(newMockGraphNode("a", "b")), `graph node "a" depends on unknown node: "b"`},
+		"Self Cycle":   {NewGraph(newMockGraphNode("a", "a")), "graph has a cycle: a -> a"},
+		"Long Cycle":   {NewGraph(newMockGraphNode("a", "c"), newMockGraphNode("b", "a"), newMockGraphNode("c", "b")), "graph has a cycle: a -> c -> b -> a"},
+		"Nested Cycle": {NewGraph(newMockGraphNode("root"), newMockGraphNode("a", "root", "b"), newMockGraphNode("b", "a")), "graph has a cycle: a -> b -> a"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := tc.graph.Validate()
+			if tc.err == "" {
+				if err != nil {
+					t.Errorf("Should be nil, but got: %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("Should be %s, but got: %v", tc.err, err)
+			}
+		})
+	}
+}
+
+func TestAgentRunGraph(t *testing.T) {
+	t.Run("Parallel", func(t *testing.T) {
+		var (
+			mu      sync.Mutex
+			paths   []string
+			started = make(chan struct{})
+			waiting int
+		)
+		agent := &Agent{Client: mockFuncClient(func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			paths = append(paths, req.URL.Path)
+			if req.URL.Path != "/auth" && req.URL.Path != "/aggregate" {
+				waiting++
+				if waiting == 3 {
+					close(started)
+				}
+			}
+			mu.Unlock()
+
+			if req.URL.Path != "/auth" && req.URL.Path != "/aggregate" {
+				select {
+				case <-started:
+				case <-time.After(time.Second):
+					return nil, errors.New("Should run in parallel")
+				}
+			}
+			return mockResponse{200, map[string]string{"Content-Type": "application/json"}, []byte(`{}`)}.MockResponse(req), nil
+		})}
+
+		var depResults FlowResults
+		aggregate := newMockGraphNode("aggregate", "a", "b", "c")
+		aggregate.Session = func(results FlowResults) (Session, error) {
+			depResults = results
+			return newMockFlowSession("/aggregate", ""), nil
+		}
+		graph := NewGraph(aggregate, newMockGraphNode("a", "auth"), newMockGraphNode("b", "auth"), newMockGraphNode("c", "auth"))
+		graph.AddNode(newMockGraphNode("auth"))
+
+		result, err := agent.RunGraph(context.Background(), graph)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if paths[0] != "/auth" || paths[4] != "/aggregate" {
+			t.Errorf("Should run in topological order, but got: %v", paths)
+		}
+		if len(depResults) != 3 || depResults["a"] == nil || depResults["b"] == nil || depResults["c"] == nil {
+			t.Errorf("Should have the results of dependencies, but got: %v", depResults)
+		}
+		if len(result.Results) != 5 {
+			t.Errorf("Should have 5 results, but got: %d", len(result.Results))
+		}
+		for name, status := range result.Statuses {
+			if status != NodeSucceeded {
+				t.Errorf("%s: Should be succeeded, but got: %s", name, status)
+			}
+		}
+	})
+
+	t.Run("Failure", func(t *testing.T) {
+		var (
+			mu    sync.Mutex
+			paths []string
+		)
+		agent := &Agent{Client: mockFuncClient(func(req *http.Request) (*http.Response, error) {
+			mu.Lock()
+			paths = append(paths, req.URL.Path)
+			mu.Unlock()
+
+			if req.URL.Path == "/b" {
+				return nil, errors.New("MOCK REQUEST ERROR DAYO")
+			}
+			return mockResponse{200, map[string]string{"Content-Type": "application/json"}, []byte(`{}`)}.MockResponse(req), nil
+		})}
+
+		graph := NewGraph(
+			newMockGraphNode("auth"),
+			newMockGraphNode("a", "auth"),
+			newMockGraphNode("b", "auth"),
+			newMockGraphNode("c", "b"),
+			newMockGraphNode("d", "a", "c"),
+		)
+		result, err := agent.RunGraph(context.Background(), graph)
+		gerr, ok := err.(*GraphError)
+		if !ok {
+			t.Fatalf("Should be GraphError, but got: %v", err)
+		}
+		if diff := cmp.Diff(gerr.Failed, []string{"b"}); diff != "" {
+			t.Errorf("Should no diff, but got: %s", diff)
+		}
+		if s := gerr.Error(); s != "Graph node failed: b: GET http://example.com/b: transport error (attempt 1): MOCK REQUEST ERROR DAYO" {
+			t.Errorf("Unexpected error message: %s", s)
+		}
+
+		expected := map[string]NodeStatus{
+			"auth": NodeSucceeded,
+			"a":    NodeSucceeded,
+			"b":    NodeFailed,
+			"c":    NodeCanceled,
+			"d":    NodeCanceled,
+		}
+		if diff := cmp.Diff(result.Statuses, expected); diff != "" {
+			t.Errorf("Should no diff, but got: %s", diff)
+		}
+		if result.Errors["c"] == nil || result.Errors["d"] == nil {
+			t.Errorf("Should have errors of canceled nodes, but got: %v", result.Errors)
+		}
+		for _, path := range paths {
+			if path == "/c" || path == "/d" {
+				t.Errorf("Should not send %s", path)
+			}
+		}
+	})
+
+	t.Run("Canceled", func(t *testing.T) {
+		agent := &Agent{Client: mockFuncClient(func(req *http.Request) (*http.Response, error) {
+			t.Errorf("Should not send %s", req.URL.Path)
+			return nil, errors.New("unreachable")
+		})}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		graph := NewGraph(
+			newMockGraphNode("auth"),
+			newMockGraphNode("a", "auth"),
+			newMockGraphNode("b", "a"),
+		)
+		result, err := agent.RunGraph(ctx, graph)
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Should be context.Canceled, but got: %v", err)
+		}
+		var gerr *GraphError
+		if errors.As(err, &gerr) {
+			t.Errorf("Should not be GraphError, but got: %v", gerr)
+		}
+
+		expected := map[string]NodeStatus{
+			"auth": NodeCanceled,
+			"a":    NodeCanceled,
+			"b":    NodeCanceled,
+		}
+		if diff := cmp.Diff(result.Statuses, expected); diff != "" {
+			t.Errorf("Should no diff, but got: %s", diff)
+		}
+		for name := range expected {
+			if !errors.Is(result.Errors[name], context.Canceled) {
+				t.Errorf("%s: Should be context.Canceled, but got: %v", name, result.Errors[name])
+			}
+		}
+	})
+
+	t.Run("Cycle", func(t *testing.T) {
+		agent := &Agent{Client: mockFuncClient(func(req *http.Request) (*http.Response, error) {
+			t.Error("Should not send")
+			return nil, errors.New("unreachable")
+		})}
+
+		_, err := agent.RunGraph(context.Background(), NewGraph(newMockGraphNode("a", "b"), newMockGraphNode("b", "a")))
+		if err == nil {
+			t.Fatal("Should not be nil")
+		}
+	})
+}
@@ -0,0 +1,49 @@
+package httpflow
+
+import (
+	"net/http"
+	"net/textproto"
+)
+
+// HeaderMergeMode tells how to merge the header values of the same name.
+type HeaderMergeMode int
+
+const (
+	// HeaderReplace replaces the existing values with the new ones.
+	HeaderReplace HeaderMergeMode = iota
+	// HeaderAppend appends the new values after the existing ones.
+	HeaderAppend
+	// HeaderKeep adds the new values only when there is no existing value.
+	HeaderKeep
+)
+
+// MergeHeader merges all values of src into dst with canonicalizing their names.
+func MergeHeader(dst, src http.Header, mode HeaderMergeMode) {
+	for name, values := range src {
+		if len(values) == 0 {
+			continue
+		}
+
+		key := textproto.CanonicalMIMEHeaderKey(name)
+		switch mode {
+		case HeaderAppend:
+			dst[key] = append(dst[key], values...)
+		case HeaderKeep:
+			if len(dst[key]) == 0 {
+				dst[key] = append([]string(nil), values...)
+			}
+		default:
+			dst[key] = append([]string(nil), values...)
+		}
+	}
+}
+
+// HeaderMiddleware merges the header into every request by the mode.
+func HeaderMiddleware(header http.Header, mode HeaderMergeMode) Middleware {
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(session Session, req *http.Request) (*http.Response, error) {
+			MergeHeader(req.Header, header, mode)
+			return next(session, req)
+		}
+	}
+}
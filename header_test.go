@@ -0,0 +1,92 @@
+package httpflow
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMergeHeader(t *testing.T) {
+	newHeader := func() http.Header {
+		return http.Header{
+			"Accept": {"text/html"},
+			"Via":    {"1.0 fred"},
+		}
+	}
+	src := http.Header{
+		"accept":        {"application/json", "text/plain"},
+		"X-Request-Id":  {"foo"},
+		"x-empty-value": {},
+	}
+
+	for name, tc := range map[string]struct {
+		mode     HeaderMergeMode
+		expected http.Header
+	}{
+		"Replace": {HeaderReplace, http.Header{
+			"Accept":       {"application/json", "text/plain"},
+			"Via":          {"1.0 fred"},
+			"X-Request-Id": {"foo"},
+		}},
+		"Append": {HeaderAppend, http.Header{
+			"Accept":       {"text/html", "application/json", "text/plain"},
+			"Via":          {"1.0 fred"},
+			"X-Request-Id": {"foo"},
+		}},
+		"Keep": {HeaderKeep, http.Header{
+			"Accept":       {"text/html"},
+			"Via":          {"1.0 fred"},
+			"X-Request-Id": {"foo"},
+		}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			dst := newHeader()
+			MergeHeader(dst, src, tc.mode)
+			if diff := cmp.Diff(dst, tc.expected); diff != "" {
+				t.Errorf("Should no diff, but got: %s", diff)
+			}
+		})
+	}
+
+	t.Run("Not Shared", func(t *testing.T) {
+		dst := http.Header{}
+		MergeHeader(dst, src, HeaderReplace)
+		dst.Add("Accept", "text/html")
+		if len(src["accept"]) != 2 {
+			t.Errorf("Should not modify src, but got: %v", src["accept"])
+		}
+	})
+}
+
+func TestHeaderMiddleware(t *testing.T) {
+	agent := Agent{Client: mockClient{mockResponse: mockResponse{statusCode: 200}}}
+	agent.Use(
+		HeaderMiddleware(http.Header{"Via": {"1.1 middleware"}}, HeaderAppend),
+		HeaderMiddleware(http.Header{"user-agent": {"httpflow"}}, HeaderKeep),
+	)
+
+	session := &mockSession{}
+	builder := &RawRequestBuilder{
+		RequestMethod: http.MethodGet,
+		RequestHeader: http.Header{"Via": {"1.0 builder"}, "User-Agent": {"builder"}},
+		RequestURL:    mustParseURL("http://example.com/"),
+	}
+	req, err := builder.BuildRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.request = req
+
+	if err := agent.RunSession(session); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := http.Header{
+		"Via":        {"1.0 builder", "1.1 middleware"},
+		"User-Agent": {"builder"},
+	}
+	if diff := cmp.Diff(session.response.Request.Header, expected); diff != "" {
+		t.Errorf("Should no diff, but got: %s", diff)
+	}
+}
@@ -0,0 +1,240 @@
+package httpflow
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrBodyNotRewindable is returned when the request is rebuilt, e.g. for retry,
+// but the body which has been read cannot be rewound.
+var ErrBodyNotRewindable = errors.New("httpflow: request body cannot be rewound")
+
+type MultipartFile struct {
+	FieldName string
+	FileName  string
+	// ContentType defaults to application/octet-stream.
+	ContentType string
+	Body        io.Reader
+	// Size is the byte size of Body. Zero means to detect it from Body if possible.
+	Size int64
+}
+
+func (f *MultipartFile) size() (int64, bool) {
+	if f.Size > 0 {
+		return f.Size, true
+	}
+
+	switch body := f.Body.(type) {
+	case nil:
+		return 0, true
+	case interface{ Len() int }:
+		return int64(body.Len()), true
+	case *os.File:
+		info, err := body.Stat()
+		if err != nil || !info.Mode().IsRegular() {
+			return 0, false
+		}
+		offset, err := body.Seek(0, io.SeekCurrent)
+		if err != nil {
+			return 0, false
+		}
+		return info.Size() - offset, true
+	}
+	return 0, false
+}
+
+// MultipartRequestBuilder builds a multipart/form-data request.
+// The body is streamed through a pipe, so the files are not buffered in memory.
+// Content-Length is set only if the sizes of all files are known.
+// The file bodies are rewound on rebuild if they implement io.Seeker, or ErrBodyNotRewindable is returned.
+type MultipartRequestBuilder struct {
+	RequestMethod       string
+	RequestHeader       http.Header
+	RequestURL          *url.URL
+	RequestURLTemplate  string
+	RequestURLVariables interface{}
+	RequestQuery        interface{}
+	RequestFields       url.Values
+	RequestFiles        []MultipartFile
+
+	body    *multipartBody
+	offsets []int64
+}
+
+var _ RequestBuilder = &MultipartRequestBuilder{}
+
+// multipartBody starts writing the parts on the first Read,
+// so no goroutine is left behind if the request is never sent.
+type multipartBody struct {
+	*io.PipeReader
+	write   func()
+	once    sync.Once
+	started bool
+	done    chan struct{}
+}
+
+func (b *multipartBody) Read(p []byte) (int, error) {
+	b.once.Do(func() {
+		b.started = true
+		go func() {
+			defer close(b.done)
+			b.write()
+		}()
+	})
+	return b.PipeReader.Read(p)
+}
+
+// stop closes the body and waits for the writer. It reports whether the body has been read.
+func (b *multipartBody) stop() bool {
+	b.PipeReader.Close()
+	b.once.Do(func() { close(b.done) })
+	<-b.done
+	return b.started
+}
+
+func (r *MultipartRequestBuilder) rewind() error {
+	if r.body == nil || !r.body.stop() {
+		r.offsets = make([]int64, len(r.RequestFiles))
+		for i, file := range r.RequestFiles {
+			if seeker, ok := file.Body.(io.Seeker); ok {
+				offset, err := seeker.Seek(0, io.SeekCurrent)
+				if err != nil {
+					return err
+				}
+				r.offsets[i] = offset
+			}
+		}
+		return nil
+	}
+
+	for i, file := range r.RequestFiles {
+		if file.Body == nil {
+			continue
+		}
+		seeker, ok := file.Body.(io.Seeker)
+		if !ok || i >= len(r.offsets) {
+			return ErrBodyNotRewindable
+		}
+		if _, err := seeker.Seek(r.offsets[i], io.SeekStart); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MultipartRequestBuilder) BuildRequest() (*http.Request, error) {
+	if err := r.rewind(); err != nil {
+		return nil, err
+	}
+
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+	body := &multipartBody{
+		PipeReader: pr,
+		write:      func() { pw.CloseWithError(r.writeParts(writer, true)) },
+		done:       make(chan struct{}),
+	}
+
+	raw := &RawRequestBuilder{
+		RequestMethod:       r.RequestMethod,
+		RequestHeader:       r.RequestHeader,
+		RequestURL:          r.RequestURL,
+		RequestURLTemplate:  r.RequestURLTemplate,
+		RequestURLVariables: r.RequestURLVariables,
+		RequestQuery:        r.RequestQuery,
+		RequestBody:         body,
+	}
+	req, err := raw.BuildRequest()
+	if err != nil {
+		pr.Close()
+		return nil, err
+	}
+	r.body = body
+
+	// the boundary must match with the body
+	req.Header.Set(contentTypeHeaderName, writer.FormDataContentType())
+	if contentLength, ok := r.contentLength(writer.Boundary()); ok {
+		req.ContentLength = contentLength
+	}
+
+	return req, nil
+}
+
+func (r *MultipartRequestBuilder) contentLength(boundary string) (int64, bool) {
+	var total int64
+	for i := range r.RequestFiles {
+		size, ok := r.RequestFiles[i].size()
+		if !ok {
+			return 0, false
+		}
+		total += size
+	}
+
+	counter := &countingWriter{}
+	writer := multipart.NewWriter(counter)
+	if err := writer.SetBoundary(boundary); err != nil {
+		return 0, false
+	}
+	if err := r.writeParts(writer, false); err != nil {
+		return 0, false
+	}
+	return counter.n + total, true
+}
+
+func (r *MultipartRequestBuilder) writeParts(writer *multipart.Writer, withFiles bool) error {
+	names := make([]string, 0, len(r.RequestFields))
+	for name := range r.RequestFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		for _, value := range r.RequestFields[name] {
+			if err := writer.WriteField(name, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, file := range r.RequestFiles {
+		contentType := file.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		header := textproto.MIMEHeader{}
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, quoteEscaper.Replace(file.FieldName), quoteEscaper.Replace(file.FileName)))
+		header.Set(contentTypeHeaderName, contentType)
+		part, err := writer.CreatePart(header)
+		if err != nil {
+			return err
+		}
+
+		if withFiles && file.Body != nil {
+			if _, err := io.Copy(part, file.Body); err != nil {
+				return err
+			}
+		}
+	}
+	return writer.Close()
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,315 @@
+package httpflow
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type mockMultipartPart struct {
+	FormName    string
+	FileName    string
+	ContentType string
+	Body        string
+}
+
+func readMultipartRequest(t *testing.T, req *http.Request) ([]mockMultipartPart, int64) {
+	mediatype, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mediatype != "multipart/form-data" {
+		t.Fatalf("Should be multipart/form-data, but got: %s", mediatype)
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var parts []mockMultipartPart
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		b, err := ioutil.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		parts = append(parts, mockMultipartPart{
+			FormName:    part.FormName(),
+			FileName:    part.FileName(),
+			ContentType: part.Header.Get("Content-Type"),
+			Body:        string(b),
+		})
+	}
+	return parts, int64(len(body))
+}
+
+type mockReadRecorder struct {
+	io.Reader
+	read bool
+}
+
+func (r *mockReadRecorder) Read(p []byte) (int, error) {
+	r.read = true
+	return r.Reader.Read(p)
+}
+
+type mockMultipartSession struct {
+	MultipartRequestBuilder
+	NobodyResponseHandler
+}
+
+func TestMultipartRequestBuilderRetry(t *testing.T) {
+	var bodies []string
+	statusCodes := []int{503, 200}
+	agent := Agent{
+		Client: mockFuncClient(func(req *http.Request) (*http.Response, error) {
+			parts, length := readMultipartRequest(t, req)
+			if req.ContentLength != length {
+				t.Errorf("Should be %d, but got: %d", length, req.ContentLength)
+			}
+			for _, part := range parts {
+				bodies = append(bodies, part.Body)
+			}
+
+			res := mockResponse{statusCode: statusCodes[0]}.MockResponse(req)
+			statusCodes = statusCodes[1:]
+			return res, nil
+		}),
+		RetryPolicy: &RetryPolicy{MaxAttempts: 2, InitialBackoff: time.Millisecond, RetryNonIdempotent: true},
+	}
+
+	session := &mockMultipartSession{
+		MultipartRequestBuilder: MultipartRequestBuilder{
+			RequestMethod: http.MethodPost,
+			RequestURL:    mustParseURL("http://example.com/upload"),
+			RequestFiles: []MultipartFile{
+				{FieldName: "file", FileName: "file.txt", Body: strings.NewReader("content")},
+			},
+		},
+	}
+	session.ExpectStatusCode(200)
+	if err := agent.RunSession(session); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff([]string{"content", "content"}, bodies); diff != "" {
+		t.Errorf("Should send the whole file on every attempt: %s", diff)
+	}
+}
+
+func TestMultipartRequestBuilder(t *testing.T) {
+	reqURL := mustParseURL("http://localhost/upload")
+
+	t.Run("Known Size", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "data.bin")
+		if err := ioutil.WriteFile(path, []byte("binary data"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		r := &MultipartRequestBuilder{
+			RequestMethod: http.MethodPost,
+			RequestHeader: http.Header{"Content-Type": {"text/plain"}},
+			RequestURL:    reqURL,
+			RequestFields: url.Values{"title": {"foo"}, "desc": {"bar", "baz"}},
+			RequestFiles: []MultipartFile{
+				{FieldName: "text", FileName: `a "quoted".txt`, ContentType: "text/plain", Body: strings.NewReader("hello")},
+				{FieldName: "file", FileName: "data.bin", Body: file},
+				{FieldName: "sized", FileName: "sized.txt", Body: io.MultiReader(strings.NewReader("sized")), Size: 5},
+			},
+		}
+
+		req, err := r.BuildRequest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.Method != http.MethodPost {
+			t.Errorf("Should got POST method, but got: %s", req.Method)
+		}
+
+		parts, length := readMultipartRequest(t, req)
+		if req.ContentLength != length {
+			t.Errorf("Should be %d, but got: %d", length, req.ContentLength)
+		}
+
+		expected := []mockMultipartPart{
+			{FormName: "desc", Body: "bar"},
+			{FormName: "desc", Body: "baz"},
+			{FormName: "title", Body: "foo"},
+			{FormName: "text", FileName: `a "quoted".txt`, ContentType: "text/plain", Body: "hello"},
+			{FormName: "file", FileName: "data.bin", ContentType: "application/octet-stream", Body: "binary data"},
+			{FormName: "sized", FileName: "sized.txt", ContentType: "application/octet-stream", Body: "sized"},
+		}
+		if diff := cmp.Diff(parts, expected); diff != "" {
+			t.Errorf("Should no diff, but got: %s", diff)
+		}
+	})
+
+	t.Run("Unknown Size", func(t *testing.T) {
+		r := &MultipartRequestBuilder{
+			RequestMethod: http.MethodPost,
+			RequestURL:    reqURL,
+			RequestFiles: []MultipartFile{
+				{FieldName: "file", FileName: "stream.txt", Body: io.MultiReader(strings.NewReader("stream"))},
+			},
+		}
+
+		req, err := r.BuildRequest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.ContentLength != 0 {
+			t.Errorf("Should be unknown, but got: %d", req.ContentLength)
+		}
+
+		parts, _ := readMultipartRequest(t, req)
+		expected := []mockMultipartPart{
+			{FormName: "file", FileName: "stream.txt", ContentType: "application/octet-stream", Body: "stream"},
+		}
+		if diff := cmp.Diff(parts, expected); diff != "" {
+			t.Errorf("Should no diff, but got: %s", diff)
+		}
+	})
+
+	t.Run("Read Error", func(t *testing.T) {
+		r := &MultipartRequestBuilder{
+			RequestMethod: http.MethodPost,
+			RequestURL:    reqURL,
+			RequestFiles: []MultipartFile{
+				{FieldName: "file", FileName: "error.txt", Body: &mockErrReader{err: errors.New("MOCK READ ERROR DAYO")}},
+			},
+		}
+
+		req, err := r.BuildRequest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := ioutil.ReadAll(req.Body); err == nil || err.Error() != "MOCK READ ERROR DAYO" {
+			t.Errorf("Should be MOCK READ ERROR DAYO, but got: %v", err)
+		}
+	})
+
+	t.Run("Rebuild", func(t *testing.T) {
+		f, err := os.CreateTemp(t.TempDir(), "file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if _, err := f.WriteString("os.File content"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+
+		r := &MultipartRequestBuilder{
+			RequestMethod: http.MethodPost,
+			RequestURL:    reqURL,
+			RequestFiles: []MultipartFile{
+				{FieldName: "a", FileName: "a.txt", Body: bytes.NewReader([]byte("bytes.Reader content"))},
+				{FieldName: "b", FileName: "b.txt", Body: f},
+			},
+		}
+		for i := 0; i < 2; i++ {
+			req, err := r.BuildRequest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			parts, length := readMultipartRequest(t, req)
+			if len(parts) != 2 || parts[0].Body != "bytes.Reader content" || parts[1].Body != "os.File content" {
+				t.Errorf("#%d: Should send the whole files, but got: %+v", i, parts)
+			}
+			if req.ContentLength != length {
+				t.Errorf("#%d: Should be %d, but got: %d", i, length, req.ContentLength)
+			}
+		}
+	})
+
+	t.Run("Not Rewindable", func(t *testing.T) {
+		r := &MultipartRequestBuilder{
+			RequestMethod: http.MethodPost,
+			RequestURL:    reqURL,
+			RequestFiles: []MultipartFile{
+				{FieldName: "file", FileName: "file.txt", Body: io.MultiReader(strings.NewReader("content"))},
+			},
+		}
+
+		// not read yet
+		if _, err := r.BuildRequest(); err != nil {
+			t.Fatal(err)
+		}
+		req, err := r.BuildRequest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if parts, _ := readMultipartRequest(t, req); len(parts) != 1 || parts[0].Body != "content" {
+			t.Errorf("Should send the whole file, but got: %+v", parts)
+		}
+
+		if _, err := r.BuildRequest(); err != ErrBodyNotRewindable {
+			t.Errorf("Should be ErrBodyNotRewindable, but got: %v", err)
+		}
+	})
+
+	t.Run("Not Sent", func(t *testing.T) {
+		body := &mockReadRecorder{Reader: strings.NewReader("content")}
+		r := &MultipartRequestBuilder{
+			RequestMethod: http.MethodPost,
+			RequestURL:    reqURL,
+			RequestFiles: []MultipartFile{
+				{FieldName: "file", FileName: "file.txt", Body: body},
+			},
+		}
+
+		req, err := r.BuildRequest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := req.Body.Close(); err != nil {
+			t.Fatal(err)
+		}
+		r.body.stop() // waits for the writer if it has been started
+		if body.read {
+			t.Error("Should not start writing the body until it is read")
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		r := &MultipartRequestBuilder{
+			RequestMethod: "INVALID!@#$%^&**()_+|-=\\`~",
+			RequestURL:    reqURL,
+		}
+
+		req, err := r.BuildRequest()
+		if req != nil {
+			t.Errorf("Should be nil, but got: %v", req)
+		}
+		if err == nil {
+			t.Fatalf("Should not be nil")
+		}
+	})
+}
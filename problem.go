@@ -0,0 +1,111 @@
+package httpflow
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+var problemJSONMediaTypes = []string{"application/problem+json"}
+
+// ProblemError is a problem details object defined in RFC 9457 (obsoletes RFC 7807).
+type ProblemError struct {
+	Type     string
+	Title    string
+	Status   int
+	Detail   string
+	Instance string
+	// Extensions has the extension members.
+	Extensions map[string]interface{}
+}
+
+var problemMemberNames = []string{"type", "title", "status", "detail", "instance"}
+
+func (e *ProblemError) Error() string {
+	title := e.Title
+	if title == "" {
+		title = e.Type
+	}
+	if title == "" {
+		title = "about:blank"
+	}
+
+	msg := fmt.Sprintf("Problem %s", title)
+	if e.Status != 0 {
+		msg += fmt.Sprintf(" (%d)", e.Status)
+	}
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+// UnmarshalJSON ignores the members which have an invalid type as the RFC requires.
+func (e *ProblemError) UnmarshalJSON(data []byte) error {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+
+	*e = ProblemError{}
+	unmarshalProblemMember(members["type"], &e.Type)
+	unmarshalProblemMember(members["title"], &e.Title)
+	unmarshalProblemMember(members["status"], &e.Status)
+	unmarshalProblemMember(members["detail"], &e.Detail)
+	unmarshalProblemMember(members["instance"], &e.Instance)
+	for _, name := range problemMemberNames {
+		delete(members, name)
+	}
+
+	for name, raw := range members {
+		var v interface{}
+		if err := json.Unmarshal(raw, &v); err != nil {
+			return err
+		}
+		if e.Extensions == nil {
+			e.Extensions = map[string]interface{}{}
+		}
+		e.Extensions[name] = v
+	}
+	return nil
+}
+
+func unmarshalProblemMember(raw json.RawMessage, v interface{}) {
+	if raw != nil {
+		_ = json.Unmarshal(raw, v)
+	}
+}
+
+// DecodeExtension decodes the extension member into v.
+func (e *ProblemError) DecodeExtension(name string, v interface{}) error {
+	ext, ok := e.Extensions[name]
+	if !ok {
+		return fmt.Errorf("httpflow: problem has no extension member %q", name)
+	}
+
+	data, err := json.Marshal(ext)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// IsProblem reports whether the response is a problem details object.
+func (h *BinaryResponseHandler) IsProblem() bool {
+	return MatchMediaType(ParseMediaType(h.Header), problemJSONMediaTypes)
+}
+
+// Problem decodes the body as a problem details object.
+func (h *BinaryResponseHandler) Problem() (*ProblemError, error) {
+	if !h.IsProblem() {
+		return nil, &UnexpectedContentTypeError{
+			ContentType: h.Header.Get(contentTypeHeaderName),
+			Body:        h.Bytes(),
+		}
+	}
+
+	var problem ProblemError
+	if err := json.Unmarshal(h.Bytes(), &problem); err != nil {
+		return nil, err
+	}
+	return &problem, nil
+}
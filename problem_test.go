@@ -0,0 +1,140 @@
+package httpflow
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestProblemError(t *testing.T) {
+	t.Run("Unmarshal", func(t *testing.T) {
+		var problem ProblemError
+		err := json.Unmarshal([]byte(`{
+			"type": "https://example.com/probs/out-of-credit",
+			"title": "You do not have enough credit.",
+			"status": 403,
+			"detail": "Your current balance is 30, but that costs 50.",
+			"instance": "/account/12345/msgs/abc",
+			"balance": 30,
+			"accounts": ["/account/12345", "/account/67890"]
+		}`), &problem)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := ProblemError{
+			Type:     "https://example.com/probs/out-of-credit",
+			Title:    "You do not have enough credit.",
+			Status:   403,
+			Detail:   "Your current balance is 30, but that costs 50.",
+			Instance: "/account/12345/msgs/abc",
+			Extensions: map[string]interface{}{
+				"balance":  float64(30),
+				"accounts": []interface{}{"/account/12345", "/account/67890"},
+			},
+		}
+		if diff := cmp.Diff(expected, problem); diff != "" {
+			t.Errorf("Unexpected problem: %s", diff)
+		}
+
+		var balance int
+		if err := problem.DecodeExtension("balance", &balance); err != nil {
+			t.Fatal(err)
+		}
+		if balance != 30 {
+			t.Errorf("Should be 30, but got: %d", balance)
+		}
+		if err := problem.DecodeExtension("unknown", &balance); err == nil {
+			t.Error("Should be error")
+		}
+	})
+
+	t.Run("Invalid Member Type", func(t *testing.T) {
+		var problem ProblemError
+		if err := json.Unmarshal([]byte(`{"title":"Not Found","status":"404"}`), &problem); err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(ProblemError{Title: "Not Found"}, problem); diff != "" {
+			t.Errorf("Unexpected problem: %s", diff)
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		for expected, problem := range map[string]*ProblemError{
+			"Problem Not Found (404): no such user": {Title: "Not Found", Status: 404, Detail: "no such user"},
+			"Problem https://example.com/probs/foo": {Type: "https://example.com/probs/foo"},
+			"Problem about:blank":                   {},
+		} {
+			if s := problem.Error(); s != expected {
+				t.Errorf("Should be %q, but got: %q", expected, s)
+			}
+		}
+	})
+}
+
+type mockProblemSession struct {
+	RawRequestBuilder
+	BinaryResponseHandler
+}
+
+func TestProblemResponse(t *testing.T) {
+	newAgent := func(contentType string, body string) *Agent {
+		return &Agent{Client: mockClient{mockResponse: mockResponse{404, map[string]string{"Content-Type": contentType}, []byte(body)}}}
+	}
+	newSession := func() *mockProblemSession {
+		session := &mockProblemSession{
+			RawRequestBuilder: RawRequestBuilder{RequestMethod: http.MethodGet, RequestURL: mustParseURL("http://example.com/users/1")},
+		}
+		session.ExpectStatusCode(200)
+		return session
+	}
+
+	t.Run("Problem", func(t *testing.T) {
+		agent := newAgent("application/problem+json; charset=utf-8", `{"title":"Not Found","status":404,"detail":"no such user"}`)
+		err := agent.RunSession(newSession())
+
+		var problem *ProblemError
+		if !errors.As(err, &problem) {
+			t.Fatalf("Should be ProblemError, but got: %v", err)
+		}
+		if problem.Detail != "no such user" {
+			t.Errorf("Should be no such user, but got: %s", problem.Detail)
+		}
+		if s := err.Error(); s != "GET http://example.com/users/1: handle error (attempt 1): Unexpected StatusCode 404: Problem Not Found (404): no such user" {
+			t.Errorf("Unexpected error message: %s", s)
+		}
+	})
+
+	t.Run("Not Problem", func(t *testing.T) {
+		agent := newAgent("application/json", `{"title":"Not Found"}`)
+		err := agent.RunSession(newSession())
+
+		var problem *ProblemError
+		if errors.As(err, &problem) {
+			t.Errorf("Should not be ProblemError, but got: %v", problem)
+		}
+		var uerr *UnexpectedStatusCodeError
+		if !errors.As(err, &uerr) {
+			t.Fatalf("Should be UnexpectedStatusCodeError, but got: %v", err)
+		}
+	})
+
+	t.Run("Broken Problem", func(t *testing.T) {
+		agent := newAgent("application/problem+json", `{`)
+		err := agent.RunSession(newSession())
+
+		var uerr *UnexpectedStatusCodeError
+		if !errors.As(err, &uerr) {
+			t.Fatalf("Should be UnexpectedStatusCodeError, but got: %v", err)
+		}
+		if uerr.Err != nil {
+			t.Errorf("Should be nil, but got: %v", uerr.Err)
+		}
+		if string(uerr.Body) != "{" {
+			t.Errorf("Should keep body, but got: %s", string(uerr.Body))
+		}
+	})
+}
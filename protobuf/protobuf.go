@@ -0,0 +1,139 @@
+// Package protobuf provides the Protocol Buffers support for httpflow.
+// Importing it registers Codec to httpflow.DefaultCodecRegistry for application/x-protobuf and application/protobuf.
+package protobuf
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	httpflow "github.com/karupanerura/go-httpflow"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+var mediaTypes = []string{"application/x-protobuf", "application/protobuf"}
+
+func init() {
+	for _, mediatype := range mediaTypes {
+		httpflow.RegisterCodec(mediatype, Codec)
+	}
+}
+
+// Codec is a httpflow.Codec with the protobuf binary wire format.
+var Codec httpflow.Codec = httpflow.CodecFuncs{
+	MarshalFunc: func(v interface{}) ([]byte, error) {
+		msg, err := asProtoMessage(v)
+		if err != nil {
+			return nil, err
+		}
+		return proto.Marshal(msg)
+	},
+	UnmarshalFunc: func(data []byte, v interface{}) error {
+		msg, err := asProtoMessage(v)
+		if err != nil {
+			return err
+		}
+		return proto.Unmarshal(data, msg)
+	},
+}
+
+// JSONCodec is a httpflow.Codec with the protobuf JSON mapping.
+var JSONCodec httpflow.Codec = httpflow.CodecFuncs{
+	MarshalFunc: func(v interface{}) ([]byte, error) {
+		msg, err := asProtoMessage(v)
+		if err != nil {
+			return nil, err
+		}
+		return protojson.Marshal(msg)
+	},
+	UnmarshalFunc: func(data []byte, v interface{}) error {
+		msg, err := asProtoMessage(v)
+		if err != nil {
+			return err
+		}
+		return protojson.Unmarshal(data, msg)
+	},
+}
+
+func asProtoMessage(v interface{}) (proto.Message, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("httpflow: %T is not a proto.Message", v)
+	}
+	return msg, nil
+}
+
+type RequestBuilder struct {
+	RequestMethod       string
+	RequestHeader       http.Header
+	RequestURL          *url.URL
+	RequestURLTemplate  string
+	RequestURLVariables interface{}
+	RequestQuery        interface{}
+	RequestBody         proto.Message
+	// JSON marshals the body with the protobuf JSON mapping instead of the binary wire format.
+	JSON bool
+}
+
+var _ httpflow.RequestBuilder = &RequestBuilder{}
+
+func (r *RequestBuilder) BuildRequest() (*http.Request, error) {
+	var reader io.Reader
+	if r.RequestBody != nil {
+		var body []byte
+		var err error
+		if r.JSON {
+			body, err = protojson.Marshal(r.RequestBody)
+		} else {
+			body, err = proto.Marshal(r.RequestBody)
+		}
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(body)
+	}
+
+	contentType := "application/x-protobuf"
+	if r.JSON {
+		contentType = "application/json"
+	}
+
+	raw := &httpflow.RawRequestBuilder{
+		RequestMethod:       r.RequestMethod,
+		RequestHeader:       r.RequestHeader,
+		RequestURL:          r.RequestURL,
+		RequestURLTemplate:  r.RequestURLTemplate,
+		RequestURLVariables: r.RequestURLVariables,
+		RequestQuery:        r.RequestQuery,
+		RequestBody:         reader,
+		DefaultContentType:  contentType,
+	}
+	return raw.BuildRequest()
+}
+
+type ResponseHandler struct {
+	httpflow.BinaryResponseHandler
+}
+
+var _ httpflow.ResponseHandler = &ResponseHandler{}
+
+func (h *ResponseHandler) IsProtobuf() bool {
+	return httpflow.MatchMediaType(httpflow.ParseMediaType(h.Header), mediaTypes)
+}
+
+// DecodeProto decodes the body with the binary wire format or with the protobuf JSON mapping by Content-Type.
+func (h *ResponseHandler) DecodeProto(msg proto.Message) error {
+	if httpflow.IsJSONMediaType(httpflow.ParseMediaType(h.Header)) {
+		return protojson.Unmarshal(h.Bytes(), msg)
+	}
+	if !h.IsProtobuf() {
+		return &httpflow.UnexpectedContentTypeError{
+			ContentType: h.Header.Get("Content-Type"),
+			Body:        h.Bytes(),
+		}
+	}
+	return proto.Unmarshal(h.Bytes(), msg)
+}
@@ -0,0 +1,191 @@
+package protobuf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"testing"
+
+	httpflow "github.com/karupanerura/go-httpflow"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func mustParseURL(s string) *url.URL {
+	u, err := url.Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return u
+}
+
+func TestRegisterCodec(t *testing.T) {
+	for _, mediatype := range []string{"application/x-protobuf", "application/protobuf"} {
+		codec, ok := httpflow.DefaultCodecRegistry.Lookup(mediatype)
+		if !ok {
+			t.Fatalf("%s: Should be registered", mediatype)
+		}
+
+		data, err := codec.Marshal(wrapperspb.String("foo"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg wrapperspb.StringValue
+		if err := proto.Unmarshal(data, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.GetValue() != "foo" {
+			t.Errorf("Should be foo, but got: %s", msg.GetValue())
+		}
+	}
+}
+
+func TestRequestBuilder(t *testing.T) {
+	t.Run("Binary", func(t *testing.T) {
+		builder := &RequestBuilder{
+			RequestMethod: http.MethodPost,
+			RequestURL:    mustParseURL("http://localhost/"),
+			RequestBody:   wrapperspb.String("foo"),
+		}
+		req, err := builder.BuildRequest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := req.Header.Get("Content-Type"); s != "application/x-protobuf" {
+			t.Errorf("Should be application/x-protobuf, but got: %s", s)
+		}
+
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg wrapperspb.StringValue
+		if err := proto.Unmarshal(body, &msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.GetValue() != "foo" {
+			t.Errorf("Should be foo, but got: %s", msg.GetValue())
+		}
+	})
+
+	t.Run("JSON", func(t *testing.T) {
+		builder := &RequestBuilder{
+			RequestMethod: http.MethodPost,
+			RequestURL:    mustParseURL("http://localhost/"),
+			RequestBody:   wrapperspb.Int64(1),
+			JSON:          true,
+		}
+		req, err := builder.BuildRequest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := req.Header.Get("Content-Type"); s != "application/json" {
+			t.Errorf("Should be application/json, but got: %s", s)
+		}
+		if body, err := ioutil.ReadAll(req.Body); string(body) != `"1"` || err != nil {
+			t.Errorf("Should be \"1\", but got: %s, error: %v", string(body), err)
+		}
+	})
+
+	t.Run("No Body", func(t *testing.T) {
+		builder := &RequestBuilder{
+			RequestMethod: http.MethodGet,
+			RequestURL:    mustParseURL("http://localhost/"),
+		}
+		req, err := builder.BuildRequest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.Body != nil {
+			t.Errorf("Should be nil, but got: %v", req.Body)
+		}
+	})
+}
+
+func TestResponseHandler(t *testing.T) {
+	binary, err := proto.Marshal(wrapperspb.String("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	json, err := protojson.Marshal(wrapperspb.String("foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for contentType, body := range map[string][]byte{
+		"application/x-protobuf":          binary,
+		"application/protobuf":            binary,
+		"application/json; charset=utf-8": json,
+		"application/json+foo":            json,
+	} {
+		t.Run(contentType, func(t *testing.T) {
+			handler := &ResponseHandler{}
+			err := handler.HandleResponse(&http.Response{
+				StatusCode: 200,
+				Header:     http.Header{"Content-Type": {contentType}},
+				Body:       ioutil.NopCloser(bytes.NewReader(body)),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var msg wrapperspb.StringValue
+			if err := handler.DecodeProto(&msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg.GetValue() != "foo" {
+				t.Errorf("Should be foo, but got: %s", msg.GetValue())
+			}
+		})
+	}
+
+	t.Run("UnexpectedContentType", func(t *testing.T) {
+		handler := &ResponseHandler{}
+		err := handler.HandleResponse(&http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": {"text/plain"}},
+			Body:       ioutil.NopCloser(bytes.NewReader(binary)),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if handler.IsProtobuf() {
+			t.Error("Should not be detected as protobuf")
+		}
+
+		var msg wrapperspb.StringValue
+		if err := handler.DecodeProto(&msg); err == nil {
+			t.Error("Should be error")
+		} else if _, ok := err.(*httpflow.UnexpectedContentTypeError); !ok {
+			t.Errorf("Should be UnexpectedContentTypeError, but got: %v", err)
+		}
+	})
+}
+
+func TestCodec(t *testing.T) {
+	for name, codec := range map[string]httpflow.Codec{
+		"Binary": Codec,
+		"JSON":   JSONCodec,
+	} {
+		t.Run(name, func(t *testing.T) {
+			data, err := codec.Marshal(wrapperspb.String("foo"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var msg wrapperspb.StringValue
+			if err := codec.Unmarshal(data, &msg); err != nil {
+				t.Fatal(err)
+			}
+			if msg.GetValue() != "foo" {
+				t.Errorf("Should be foo, but got: %s", msg.GetValue())
+			}
+
+			if _, err := codec.Marshal("foo"); err == nil {
+				t.Error("Should be error for non proto.Message")
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package httpflow
+
+import (
+	"encoding"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// EncodeQuery encodes the struct into url.Values by the `query` tags of its fields.
+//
+//	Page   int       `query:"page,omitempty"`
+//	Tags   []string  `query:"tag"`                          // tag=a&tag=b
+//	IDs    []int     `query:"ids,comma"`                    // ids=1,2
+//	Since  time.Time `query:"since,omitempty"`              // RFC 3339
+//	Until  time.Time `query:"until,unix"`                   // unix time
+//	Date   time.Time `query:"date" layout:"2006-01-02"`
+//	Hidden string    `query:"-"`
+//
+// The fields without tag use their name. Nil pointers are omitted,
+// and the fields of embedded structs are encoded as the fields of the outer struct.
+func EncodeQuery(v interface{}) (url.Values, error) {
+	values := url.Values{}
+	rv := reflect.ValueOf(v)
+	for rv.IsValid() && rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return values, nil
+		}
+		rv = rv.Elem()
+	}
+	if !rv.IsValid() {
+		return values, nil
+	}
+	if rv.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("query should be a struct, but got: %s", rv.Type())
+	}
+
+	if err := encodeQueryStruct(values, rv); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+type queryTag struct {
+	name      string
+	omitEmpty bool
+	comma     bool
+	unix      bool
+	layout    string
+}
+
+func parseQueryTag(field reflect.StructField) queryTag {
+	parts := strings.Split(field.Tag.Get("query"), ",")
+	tag := queryTag{name: parts[0], layout: field.Tag.Get("layout")}
+	for _, option := range parts[1:] {
+		switch option {
+		case "omitempty":
+			tag.omitEmpty = true
+		case "comma":
+			tag.comma = true
+		case "unix":
+			tag.unix = true
+		}
+	}
+	return tag
+}
+
+func encodeQueryStruct(values url.Values, rv reflect.Value) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field := rt.Field(i)
+		tag := parseQueryTag(field)
+		if tag.name == "-" {
+			continue
+		}
+
+		fv := rv.Field(i)
+		if field.Anonymous && tag.name == "" {
+			ev := fv
+			if ev.Kind() == reflect.Ptr {
+				if ev.IsNil() {
+					continue
+				}
+				ev = ev.Elem()
+			}
+			if ev.Kind() == reflect.Struct && ev.Type() != timeType && !ev.Type().Implements(textMarshalerType) {
+				if err := encodeQueryStruct(values, ev); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if tag.name == "" {
+			tag.name = field.Name
+		}
+
+		if err := encodeQueryField(values, tag, fv); err != nil {
+			return fmt.Errorf("failed to encode query field %s: %w", field.Name, err)
+		}
+	}
+	return nil
+}
+
+func encodeQueryField(values url.Values, tag queryTag, fv reflect.Value) error {
+	for fv.Kind() == reflect.Ptr || fv.Kind() == reflect.Interface {
+		if fv.IsNil() {
+			return nil
+		}
+		fv = fv.Elem()
+	}
+	if tag.omitEmpty && fv.IsZero() {
+		return nil
+	}
+
+	if (fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() != reflect.Uint8) || fv.Kind() == reflect.Array {
+		items := make([]string, 0, fv.Len())
+		for i := 0; i < fv.Len(); i++ {
+			item := fv.Index(i)
+			if item.Kind() == reflect.Ptr && item.IsNil() {
+				continue
+			}
+			s, err := encodeQueryValue(tag, item)
+			if err != nil {
+				return err
+			}
+			items = append(items, s)
+		}
+		if tag.omitEmpty && len(items) == 0 {
+			return nil
+		}
+		if tag.comma {
+			values.Add(tag.name, strings.Join(items, ","))
+			return nil
+		}
+		for _, item := range items {
+			values.Add(tag.name, item)
+		}
+		return nil
+	}
+
+	s, err := encodeQueryValue(tag, fv)
+	if err != nil {
+		return err
+	}
+	values.Add(tag.name, s)
+	return nil
+}
+
+func encodeQueryValue(tag queryTag, v reflect.Value) (string, error) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return "", nil
+		}
+		v = v.Elem()
+	}
+
+	if v.Type() == timeType {
+		t := v.Interface().(time.Time)
+		switch {
+		case tag.unix:
+			return strconv.FormatInt(t.Unix(), 10), nil
+		case tag.layout != "":
+			return t.Format(tag.layout), nil
+		default:
+			return t.Format(time.RFC3339), nil
+		}
+	}
+	if v.Type().Implements(textMarshalerType) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	}
+	if v.CanAddr() && reflect.PtrTo(v.Type()).Implements(textMarshalerType) {
+		text, err := v.Addr().Interface().(encoding.TextMarshaler).MarshalText()
+		return string(text), err
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		return v.String(), nil
+	case reflect.Bool:
+		return strconv.FormatBool(v.Bool()), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.FormatUint(v.Uint(), 10), nil
+	case reflect.Float32:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 32), nil
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64), nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), nil
+		}
+		fallthrough
+	default:
+		return "", fmt.Errorf("unsupported type: %s", v.Type())
+	}
+}
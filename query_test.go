@@ -0,0 +1,158 @@
+package httpflow
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type mockQueryPaging struct {
+	Page    int `query:"page,omitempty"`
+	PerPage int `query:"per_page,omitempty"`
+}
+
+type mockQuery struct {
+	mockQueryPaging
+	Keyword  string     `query:"q"`
+	Tags     []string   `query:"tag"`
+	IDs      []int      `query:"ids,comma"`
+	Since    time.Time  `query:"since,omitempty"`
+	Until    *time.Time `query:"until,unix"`
+	Date     time.Time  `query:"date,omitempty" layout:"2006-01-02"`
+	Active   *bool      `query:"active"`
+	Score    float64    `query:"score,omitempty"`
+	IP       net.IP     `query:"ip,omitempty"`
+	NoTag    string
+	Ignored  string `query:"-"`
+	internal string
+}
+
+func TestEncodeQuery(t *testing.T) {
+	until := time.Date(2018, time.January, 2, 3, 4, 5, 0, time.UTC)
+	active := false
+	query := &mockQuery{
+		mockQueryPaging: mockQueryPaging{Page: 2},
+		Keyword:         "foo bar",
+		Tags:            []string{"a", "b"},
+		IDs:             []int{1, 2, 3},
+		Since:           time.Date(2018, time.January, 1, 0, 0, 0, 0, time.UTC),
+		Until:           &until,
+		Date:            until,
+		Active:          &active,
+		Score:           1.5,
+		IP:              net.ParseIP("127.0.0.1"),
+		NoTag:           "notag",
+		Ignored:         "ignored",
+		internal:        "internal",
+	}
+
+	values, err := EncodeQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := url.Values{
+		"page":   {"2"},
+		"q":      {"foo bar"},
+		"tag":    {"a", "b"},
+		"ids":    {"1,2,3"},
+		"since":  {"2018-01-01T00:00:00Z"},
+		"until":  {"1514862245"},
+		"date":   {"2018-01-02"},
+		"active": {"false"},
+		"score":  {"1.5"},
+		"ip":     {"127.0.0.1"},
+		"NoTag":  {"notag"},
+	}
+	if diff := cmp.Diff(values, expected); diff != "" {
+		t.Errorf("Should no diff, but got: %s", diff)
+	}
+
+	t.Run("Zero", func(t *testing.T) {
+		values, err := EncodeQuery(mockQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := url.Values{
+			"q":     {""},
+			"ids":   {""},
+			"NoTag": {""},
+		}
+		if diff := cmp.Diff(values, expected); diff != "" {
+			t.Errorf("Should no diff, but got: %s", diff)
+		}
+	})
+
+	t.Run("Nil", func(t *testing.T) {
+		values, err := EncodeQuery((*mockQuery)(nil))
+		if err != nil || len(values) != 0 {
+			t.Errorf("Should be empty, but got: %v, %v", values, err)
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		if _, err := EncodeQuery("foo"); err == nil {
+			t.Error("Should not be nil")
+		}
+		if _, err := EncodeQuery(struct{ Map map[string]string }{map[string]string{"a": "b"}}); err == nil {
+			t.Error("Should not be nil")
+		}
+		if _, err := EncodeQuery(struct {
+			M [][]string `query:"m"`
+		}{[][]string{{"a", "b"}}}); err == nil {
+			t.Error("Should not be nil")
+		}
+	})
+}
+
+func TestRequestBuilderQuery(t *testing.T) {
+	query := &mockQuery{
+		mockQueryPaging: mockQueryPaging{Page: 2},
+		Keyword:         "foo",
+		Tags:            []string{"a", "b"},
+	}
+	const expected = "http://localhost/users?sort=name&NoTag=&ids=&page=2&q=foo&tag=a&tag=b"
+
+	for name, builder := range map[string]RequestBuilder{
+		"Nobody": &NobodyRequestBuilder{RequestMethod: http.MethodGet, RequestURL: mustParseURL("http://localhost/users?sort=name"), RequestQuery: query},
+		"Form":   &FormRequestBuilder{RequestMethod: http.MethodGet, RequestURL: mustParseURL("http://localhost/users?sort=name"), RequestQuery: query},
+		"JSON":   &JSONRequestBuilder{RequestMethod: http.MethodGet, RequestURL: mustParseURL("http://localhost/users?sort=name"), RequestQuery: query},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req, err := builder.BuildRequest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s := req.URL.String(); s != expected {
+				t.Errorf("Should be %s, but got: %s", expected, s)
+			}
+		})
+	}
+
+	t.Run("No Existing Query", func(t *testing.T) {
+		builder := &NobodyRequestBuilder{RequestMethod: http.MethodGet, RequestURL: mustParseURL("http://localhost/users"), RequestQuery: mockQueryPaging{Page: 3}}
+		req, err := builder.BuildRequest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := req.URL.String(); s != "http://localhost/users?page=3" {
+			t.Errorf("Should be http://localhost/users?page=3, but got: %s", s)
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		builder := &NobodyRequestBuilder{RequestMethod: http.MethodGet, RequestURL: mustParseURL("http://localhost/users"), RequestQuery: "invalid"}
+		req, err := builder.BuildRequest()
+		if req != nil {
+			t.Errorf("Should be nil, but got: %v", req)
+		}
+		if err == nil {
+			t.Fatal("Should not be nil")
+		}
+	})
+}
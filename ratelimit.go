@@ -0,0 +1,262 @@
+package httpflow
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// unix time larger than this is treated as an absolute time in X-RateLimit-Reset
+const rateLimitResetEpochThreshold = 1000000000
+
+func retryAfterFromHeader(header http.Header, now time.Time) (time.Duration, bool) {
+	return parseRetryAfter(header.Get("Retry-After"), now)
+}
+
+func rateLimitRemainingFromHeader(header http.Header) (int, bool) {
+	for _, name := range []string{"RateLimit-Remaining", "X-RateLimit-Remaining"} {
+		value := strings.TrimSpace(header.Get(name))
+		if value == "" {
+			continue
+		}
+
+		remaining, err := strconv.Atoi(value)
+		if err != nil {
+			return 0, false
+		}
+		return remaining, true
+	}
+	return 0, false
+}
+
+func rateLimitResetFromHeader(header http.Header, now time.Time) (time.Time, bool) {
+	for _, name := range []string{"RateLimit-Reset", "X-RateLimit-Reset"} {
+		value := strings.TrimSpace(header.Get(name))
+		if value == "" {
+			continue
+		}
+
+		if seconds, err := strconv.ParseInt(value, 10, 64); err == nil {
+			if seconds >= rateLimitResetEpochThreshold {
+				return time.Unix(seconds, 0), true
+			}
+			return now.Add(time.Duration(seconds) * time.Second), true
+		}
+
+		date, err := http.ParseTime(value)
+		if err != nil {
+			return time.Time{}, false
+		}
+		return date, true
+	}
+	return time.Time{}, false
+}
+
+// ErrRateLimitWaitTooLong is wrapped by RateLimitError if the wait exceeds HeaderRateLimiter.MaxWait.
+var ErrRateLimitWaitTooLong = errors.New("httpflow: rate limit wait is too long")
+
+// HeaderRateLimiter pauses requests to a host until the time told by
+// the Retry-After or rate-limit headers of its previous response.
+// Use it as a middleware: agent.Use(limiter.Middleware)
+type HeaderRateLimiter struct {
+	// MaxWait is the longest wait for a request. The request fails with RateLimitError if it needs to wait longer.
+	// It defaults to DefaultMaxRetryAfter.
+	MaxWait time.Duration
+
+	mu       sync.Mutex
+	resumeAt map[string]time.Time
+}
+
+func (l *HeaderRateLimiter) Middleware(next RoundTripFunc) RoundTripFunc {
+	return func(session Session, req *http.Request) (*http.Response, error) {
+		host := req.URL.Host
+		if err := l.wait(req.Context(), host); err != nil {
+			return nil, err
+		}
+
+		res, err := next(session, req)
+		if res != nil {
+			l.observe(host, res, time.Now())
+		}
+		return res, err
+	}
+}
+
+func (l *HeaderRateLimiter) wait(ctx context.Context, host string) error {
+	wait := l.waitDuration(host, time.Now())
+	if wait > l.maxWait() {
+		return &RateLimitError{Key: host, Err: ErrRateLimitWaitTooLong}
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+		return &RateLimitError{Key: host, Err: context.DeadlineExceeded}
+	}
+
+	if err := sleepContext(ctx, wait); err != nil {
+		return &RateLimitError{Key: host, Err: err}
+	}
+	return nil
+}
+
+func (l *HeaderRateLimiter) maxWait() time.Duration {
+	if l.MaxWait > 0 {
+		return l.MaxWait
+	}
+	return DefaultMaxRetryAfter
+}
+
+func (l *HeaderRateLimiter) waitDuration(host string, now time.Time) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	resumeAt, ok := l.resumeAt[host]
+	if !ok {
+		return 0
+	}
+	if !now.Before(resumeAt) {
+		delete(l.resumeAt, host)
+		return 0
+	}
+	return resumeAt.Sub(now)
+}
+
+func (l *HeaderRateLimiter) observe(host string, res *http.Response, now time.Time) {
+	var resumeAt time.Time
+	switch res.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		if retryAfter, ok := retryAfterFromHeader(res.Header, now); ok {
+			resumeAt = now.Add(retryAfter)
+		}
+	}
+	if resumeAt.IsZero() {
+		if remaining, ok := rateLimitRemainingFromHeader(res.Header); ok && remaining <= 0 {
+			if reset, ok := rateLimitResetFromHeader(res.Header, now); ok {
+				resumeAt = reset
+			}
+		}
+	}
+	if !resumeAt.After(now) {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.resumeAt == nil {
+		l.resumeAt = map[string]time.Time{}
+	}
+	if resumeAt.After(l.resumeAt[host]) {
+		l.resumeAt[host] = resumeAt
+	}
+}
+
+type KeyFunc func(session Session, req *http.Request) string
+
+func HostKey(_ Session, req *http.Request) string {
+	return req.URL.Host
+}
+
+type RateLimiter interface {
+	// Wait blocks until a request for the key is allowed.
+	Wait(ctx context.Context, key string) error
+}
+
+func RateLimitMiddleware(limiter RateLimiter, keyFunc KeyFunc) Middleware {
+	if keyFunc == nil {
+		keyFunc = HostKey
+	}
+
+	return func(next RoundTripFunc) RoundTripFunc {
+		return func(session Session, req *http.Request) (*http.Response, error) {
+			if err := limiter.Wait(req.Context(), keyFunc(session, req)); err != nil {
+				return nil, err
+			}
+			return next(session, req)
+		}
+	}
+}
+
+// TokenBucketLimiter is a RateLimiter which has a token bucket for each key.
+type TokenBucketLimiter struct {
+	// Rate is the number of tokens added per second. Zero means no limit.
+	Rate float64
+	// Burst is the size of the bucket. It defaults to 1.
+	Burst int
+
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+var _ RateLimiter = &TokenBucketLimiter{}
+
+func (l *TokenBucketLimiter) Wait(ctx context.Context, key string) error {
+	wait := l.reserve(key, time.Now())
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+		l.cancel(key)
+		return &RateLimitError{Key: key, Err: context.DeadlineExceeded}
+	}
+
+	if err := sleepContext(ctx, wait); err != nil {
+		l.cancel(key)
+		return &RateLimitError{Key: key, Err: err}
+	}
+	return nil
+}
+
+func (l *TokenBucketLimiter) burst() float64 {
+	if l.Burst <= 0 {
+		return 1
+	}
+	return float64(l.Burst)
+}
+
+func (l *TokenBucketLimiter) reserve(key string, now time.Time) time.Duration {
+	if l.Rate <= 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.buckets == nil {
+		l.buckets = map[string]*tokenBucket{}
+	}
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: l.burst(), last: now}
+		l.buckets[key] = bucket
+	}
+
+	if elapsed := now.Sub(bucket.last); elapsed > 0 {
+		bucket.tokens = math.Min(l.burst(), bucket.tokens+elapsed.Seconds()*l.Rate)
+		bucket.last = now
+	}
+
+	bucket.tokens--
+	if bucket.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-bucket.tokens / l.Rate * float64(time.Second))
+}
+
+func (l *TokenBucketLimiter) cancel(key string) {
+	if l.Rate <= 0 {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if bucket, ok := l.buckets[key]; ok {
+		bucket.tokens = math.Min(l.burst(), bucket.tokens+1)
+	}
+}
@@ -0,0 +1,267 @@
+package httpflow
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestRateLimitHeaders(t *testing.T) {
+	now := time.Date(2015, time.October, 21, 7, 28, 0, 0, time.UTC)
+
+	t.Run("Retry-After", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("Retry-After", "Wed, 21 Oct 2015 07:28:30 GMT")
+		if d, ok := retryAfterFromHeader(header, now); !ok || d != 30*time.Second {
+			t.Errorf("Should be 30s, but got: %s", d)
+		}
+	})
+
+	t.Run("RateLimit-*", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("RateLimit-Remaining", "0")
+		header.Set("RateLimit-Reset", "30")
+		if remaining, ok := rateLimitRemainingFromHeader(header); !ok || remaining != 0 {
+			t.Errorf("Should be 0, but got: %d", remaining)
+		}
+		if reset, ok := rateLimitResetFromHeader(header, now); !ok || !reset.Equal(now.Add(30*time.Second)) {
+			t.Errorf("Should be %s, but got: %s", now.Add(30*time.Second), reset)
+		}
+	})
+
+	t.Run("X-RateLimit-*", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("X-RateLimit-Remaining", "42")
+		header.Set("X-RateLimit-Reset", "1445412510")
+		if remaining, ok := rateLimitRemainingFromHeader(header); !ok || remaining != 42 {
+			t.Errorf("Should be 42, but got: %d", remaining)
+		}
+		if reset, ok := rateLimitResetFromHeader(header, now); !ok || !reset.Equal(now.Add(30*time.Second)) {
+			t.Errorf("Should be %s, but got: %s", now.Add(30*time.Second), reset)
+		}
+	})
+
+	t.Run("HTTP-date Reset", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("X-RateLimit-Reset", "Wed, 21 Oct 2015 07:28:30 GMT")
+		if reset, ok := rateLimitResetFromHeader(header, now); !ok || !reset.Equal(now.Add(30*time.Second)) {
+			t.Errorf("Should be %s, but got: %s", now.Add(30*time.Second), reset)
+		}
+	})
+
+	t.Run("Missing", func(t *testing.T) {
+		header := http.Header{}
+		if _, ok := rateLimitRemainingFromHeader(header); ok {
+			t.Error("Should be false")
+		}
+		if _, ok := rateLimitResetFromHeader(header, now); ok {
+			t.Error("Should be false")
+		}
+	})
+
+	t.Run("NobodyResponseHandler", func(t *testing.T) {
+		header := http.Header{}
+		header.Set("Retry-After", "120")
+		header.Set("RateLimit-Remaining", "10")
+		header.Set("RateLimit-Reset", "60")
+		handler := &NobodyResponseHandler{}
+		if err := handler.HandleResponse(&http.Response{StatusCode: 429, Header: header}); err != nil {
+			t.Fatal(err)
+		}
+
+		if d, ok := handler.RetryAfter(); !ok || d != 2*time.Minute {
+			t.Errorf("Should be 2m0s, but got: %s", d)
+		}
+		if remaining, ok := handler.RateLimitRemaining(); !ok || remaining != 10 {
+			t.Errorf("Should be 10, but got: %d", remaining)
+		}
+		if reset, ok := handler.RateLimitReset(); !ok || time.Until(reset) <= 0 {
+			t.Errorf("Should be future, but got: %s", reset)
+		}
+	})
+}
+
+func TestHeaderRateLimiter(t *testing.T) {
+	now := time.Now()
+
+	t.Run("Retry-After", func(t *testing.T) {
+		limiter := &HeaderRateLimiter{}
+		header := http.Header{}
+		header.Set("Retry-After", "10")
+		limiter.observe("example.com", &http.Response{StatusCode: 429, Header: header}, now)
+
+		if d := limiter.waitDuration("example.com", now); d != 10*time.Second {
+			t.Errorf("Should be 10s, but got: %s", d)
+		}
+		if d := limiter.waitDuration("example.net", now); d != 0 {
+			t.Errorf("Should be 0s, but got: %s", d)
+		}
+		if d := limiter.waitDuration("example.com", now.Add(10*time.Second)); d != 0 {
+			t.Errorf("Should be 0s, but got: %s", d)
+		}
+	})
+
+	t.Run("RateLimit-Remaining", func(t *testing.T) {
+		limiter := &HeaderRateLimiter{}
+		header := http.Header{}
+		header.Set("RateLimit-Remaining", "1")
+		header.Set("RateLimit-Reset", "10")
+		limiter.observe("example.com", &http.Response{StatusCode: 200, Header: header}, now)
+		if d := limiter.waitDuration("example.com", now); d != 0 {
+			t.Errorf("Should be 0s, but got: %s", d)
+		}
+
+		header.Set("RateLimit-Remaining", "0")
+		limiter.observe("example.com", &http.Response{StatusCode: 200, Header: header}, now)
+		if d := limiter.waitDuration("example.com", now); d != 10*time.Second {
+			t.Errorf("Should be 10s, but got: %s", d)
+		}
+	})
+
+	t.Run("Middleware", func(t *testing.T) {
+		limiter := &HeaderRateLimiter{}
+		agent := Agent{Client: mockClient{mockResponse: mockResponse{statusCode: 429, headersMap: map[string]string{"Retry-After": "10"}}}}
+		agent.Use(limiter.Middleware)
+
+		session := newRetryTestSession(t)
+		if err := agent.RunSession(session); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		session = newRetryTestSession(t)
+		err := agent.RunSessionCtx(ctx, session)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Should be context.DeadlineExceeded, but got: %v", err)
+		}
+		var rerr *RateLimitError
+		if !errors.As(err, &rerr) || rerr.Key != "example.com" {
+			t.Errorf("Should be RateLimitError for example.com, but got: %v", err)
+		}
+		if session.handleres != 0 {
+			t.Errorf("Should not called, but called %d times", session.handleres)
+		}
+	})
+
+	t.Run("MaxWait", func(t *testing.T) {
+		limiter := &HeaderRateLimiter{MaxWait: time.Second}
+		agent := Agent{Client: mockClient{mockResponse: mockResponse{statusCode: 429, headersMap: map[string]string{"Retry-After": "4294967295"}}}}
+		agent.Use(limiter.Middleware)
+
+		if err := agent.RunSession(newRetryTestSession(t)); err != nil {
+			t.Fatal(err)
+		}
+
+		session := newRetryTestSession(t)
+		err := agent.RunSession(session)
+		var rerr *RateLimitError
+		if !errors.As(err, &rerr) || rerr.Key != "example.com" {
+			t.Errorf("Should be RateLimitError for example.com, but got: %v", err)
+		}
+		if !errors.Is(err, ErrRateLimitWaitTooLong) {
+			t.Errorf("Should be ErrRateLimitWaitTooLong, but got: %v", err)
+		}
+		if session.handleres != 0 {
+			t.Errorf("Should not called, but called %d times", session.handleres)
+		}
+	})
+}
+
+func TestTokenBucketLimiter(t *testing.T) {
+	t.Run("Reserve", func(t *testing.T) {
+		now := time.Now()
+		limiter := &TokenBucketLimiter{Rate: 10, Burst: 2}
+		for i, expected := range []time.Duration{0, 0, 100 * time.Millisecond, 200 * time.Millisecond} {
+			if d := limiter.reserve("example.com", now); d != expected {
+				t.Errorf("#%d: Should be %s, but got: %s", i, expected, d)
+			}
+		}
+		if d := limiter.reserve("example.net", now); d != 0 {
+			t.Errorf("Should be 0s, but got: %s", d)
+		}
+		if d := limiter.reserve("example.com", now.Add(time.Second)); d != 0 {
+			t.Errorf("Should be 0s, but got: %s", d)
+		}
+	})
+
+	t.Run("No Limit", func(t *testing.T) {
+		limiter := &TokenBucketLimiter{}
+		for i := 0; i < 10; i++ {
+			if err := limiter.Wait(context.Background(), "example.com"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	})
+
+	t.Run("Wait", func(t *testing.T) {
+		limiter := &TokenBucketLimiter{Rate: 100}
+		if err := limiter.Wait(context.Background(), "example.com"); err != nil {
+			t.Fatal(err)
+		}
+
+		start := time.Now()
+		if err := limiter.Wait(context.Background(), "example.com"); err != nil {
+			t.Fatal(err)
+		}
+		if elapsed := time.Since(start); elapsed < 5*time.Millisecond {
+			t.Errorf("Should wait about 10ms, but waited: %s", elapsed)
+		}
+	})
+
+	t.Run("Give Up", func(t *testing.T) {
+		limiter := &TokenBucketLimiter{Rate: 1}
+		agent := Agent{Client: mockClient{mockResponse: mockResponse{statusCode: 200}}}
+		agent.Use(RateLimitMiddleware(limiter, nil))
+
+		session := newRetryTestSession(t)
+		if err := agent.RunSession(session); err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+
+		session = newRetryTestSession(t)
+		err := agent.RunSessionCtx(ctx, session)
+		var rerr *RateLimitError
+		if !errors.As(err, &rerr) {
+			t.Fatalf("Should be RateLimitError, but got: %v", err)
+		}
+		if rerr.Key != "example.com" {
+			t.Errorf("Should be example.com, but got: %s", rerr.Key)
+		}
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Should be context.DeadlineExceeded, but got: %v", rerr.Err)
+		}
+		if session.handleres != 0 {
+			t.Errorf("Should not called, but called %d times", session.handleres)
+		}
+
+		// the canceled reservation should be returned
+		if d := limiter.reserve("example.com", time.Now()); d > time.Second {
+			t.Errorf("Should be less than 1s, but got: %s", d)
+		}
+	})
+
+	t.Run("Key", func(t *testing.T) {
+		limiter := &TokenBucketLimiter{Rate: 1}
+		agent := Agent{Client: mockClient{mockResponse: mockResponse{statusCode: 200}}}
+		var keys []string
+		agent.Use(RateLimitMiddleware(limiter, func(_ Session, req *http.Request) string {
+			key := req.Method + " " + req.URL.Path
+			keys = append(keys, key)
+			return key
+		}))
+
+		if err := agent.RunSession(newRetryTestSession(t)); err != nil {
+			t.Fatal(err)
+		}
+		if len(keys) != 1 || keys[0] != "GET /" {
+			t.Errorf("Should be [GET /], but got: %v", keys)
+		}
+	})
+}
@@ -3,6 +3,7 @@ package httpflow
 import (
 	"bytes"
 	"encoding/json"
+	"encoding/xml"
 	"io"
 	"net/http"
 	"net/url"
@@ -14,58 +15,100 @@ type RequestBuilder interface {
 }
 
 type RawRequestBuilder struct {
-	RequestMethod      string
-	RequestHeader      http.Header
-	RequestURL         *url.URL
+	RequestMethod string
+	RequestHeader http.Header
+	RequestURL    *url.URL
+	// RequestURLTemplate is an RFC 6570 URI template used instead of RequestURL if it is not empty.
+	RequestURLTemplate  string
+	RequestURLVariables interface{}
+	// RequestQuery is a struct to be encoded by EncodeQuery and added to the query of the URL.
+	RequestQuery       interface{}
 	RequestBody        io.Reader
 	DefaultContentType string
+	DefaultAccept      string
 }
 
 var _ RequestBuilder = &RawRequestBuilder{}
 
 func (r *RawRequestBuilder) BuildRequest() (*http.Request, error) {
-	req, err := http.NewRequest(r.RequestMethod, r.RequestURL.String(), r.RequestBody)
+	reqURL, err := r.requestURL()
 	if err != nil {
 		return nil, err
 	}
 
-	if r.RequestHeader != nil {
-		for name := range r.RequestHeader {
-			value := r.RequestHeader.Get(name)
-			req.Header.Set(name, value)
+	req, err := http.NewRequest(r.RequestMethod, reqURL, r.RequestBody)
+	if err != nil {
+		return nil, err
+	}
+
+	if r.RequestQuery != nil {
+		query, err := EncodeQuery(r.RequestQuery)
+		if err != nil {
+			return nil, err
+		}
+		if encoded := query.Encode(); encoded != "" {
+			if req.URL.RawQuery != "" {
+				encoded = req.URL.RawQuery + "&" + encoded
+			}
+			req.URL.RawQuery = encoded
 		}
 	}
 
+	if r.RequestHeader != nil {
+		MergeHeader(req.Header, r.RequestHeader, HeaderReplace)
+	}
+
 	if r.DefaultContentType != "" {
 		if req.Header.Get(contentTypeHeaderName) == "" {
 			req.Header.Set(contentTypeHeaderName, r.DefaultContentType)
 		}
 	}
+	if r.DefaultAccept != "" {
+		if req.Header.Get("Accept") == "" {
+			req.Header.Set("Accept", r.DefaultAccept)
+		}
+	}
 	return req, nil
 }
 
+func (r *RawRequestBuilder) requestURL() (string, error) {
+	if r.RequestURLTemplate != "" {
+		return ExpandURITemplate(r.RequestURLTemplate, r.RequestURLVariables)
+	}
+	return r.RequestURL.String(), nil
+}
+
 type NobodyRequestBuilder struct {
-	RequestMethod string
-	RequestHeader http.Header
-	RequestURL    *url.URL
+	RequestMethod       string
+	RequestHeader       http.Header
+	RequestURL          *url.URL
+	RequestURLTemplate  string
+	RequestURLVariables interface{}
+	RequestQuery        interface{}
 }
 
 var _ RequestBuilder = &NobodyRequestBuilder{}
 
 func (r *NobodyRequestBuilder) BuildRequest() (*http.Request, error) {
 	raw := &RawRequestBuilder{
-		RequestMethod: r.RequestMethod,
-		RequestHeader: r.RequestHeader,
-		RequestURL:    r.RequestURL,
+		RequestMethod:       r.RequestMethod,
+		RequestHeader:       r.RequestHeader,
+		RequestURL:          r.RequestURL,
+		RequestURLTemplate:  r.RequestURLTemplate,
+		RequestURLVariables: r.RequestURLVariables,
+		RequestQuery:        r.RequestQuery,
 	}
 	return raw.BuildRequest()
 }
 
 type FormRequestBuilder struct {
-	RequestMethod string
-	RequestHeader http.Header
-	RequestURL    *url.URL
-	RequestBody   url.Values
+	RequestMethod       string
+	RequestHeader       http.Header
+	RequestURL          *url.URL
+	RequestURLTemplate  string
+	RequestURLVariables interface{}
+	RequestQuery        interface{}
+	RequestBody         url.Values
 }
 
 var _ RequestBuilder = &FormRequestBuilder{}
@@ -77,20 +120,26 @@ func (r *FormRequestBuilder) BuildRequest() (*http.Request, error) {
 	}
 
 	raw := &RawRequestBuilder{
-		RequestMethod:      r.RequestMethod,
-		RequestHeader:      r.RequestHeader,
-		RequestURL:         r.RequestURL,
-		RequestBody:        reader,
-		DefaultContentType: "application/x-www-form-urlencoded",
+		RequestMethod:       r.RequestMethod,
+		RequestHeader:       r.RequestHeader,
+		RequestURL:          r.RequestURL,
+		RequestURLTemplate:  r.RequestURLTemplate,
+		RequestURLVariables: r.RequestURLVariables,
+		RequestQuery:        r.RequestQuery,
+		RequestBody:         reader,
+		DefaultContentType:  "application/x-www-form-urlencoded",
 	}
 	return raw.BuildRequest()
 }
 
 type JSONRequestBuilder struct {
-	RequestMethod string
-	RequestHeader http.Header
-	RequestURL    *url.URL
-	RequestBody   interface{}
+	RequestMethod       string
+	RequestHeader       http.Header
+	RequestURL          *url.URL
+	RequestURLTemplate  string
+	RequestURLVariables interface{}
+	RequestQuery        interface{}
+	RequestBody         interface{}
 }
 
 var _ RequestBuilder = &JSONRequestBuilder{}
@@ -106,11 +155,49 @@ func (r *JSONRequestBuilder) BuildRequest() (*http.Request, error) {
 	}
 
 	raw := &RawRequestBuilder{
-		RequestMethod:      r.RequestMethod,
-		RequestHeader:      r.RequestHeader,
-		RequestURL:         r.RequestURL,
-		RequestBody:        reader,
-		DefaultContentType: "application/json",
+		RequestMethod:       r.RequestMethod,
+		RequestHeader:       r.RequestHeader,
+		RequestURL:          r.RequestURL,
+		RequestURLTemplate:  r.RequestURLTemplate,
+		RequestURLVariables: r.RequestURLVariables,
+		RequestQuery:        r.RequestQuery,
+		RequestBody:         reader,
+		DefaultContentType:  "application/json",
+	}
+	return raw.BuildRequest()
+}
+
+type XMLRequestBuilder struct {
+	RequestMethod       string
+	RequestHeader       http.Header
+	RequestURL          *url.URL
+	RequestURLTemplate  string
+	RequestURLVariables interface{}
+	RequestQuery        interface{}
+	RequestBody         interface{}
+}
+
+var _ RequestBuilder = &XMLRequestBuilder{}
+
+func (r *XMLRequestBuilder) BuildRequest() (*http.Request, error) {
+	var reader io.Reader
+	if r.RequestBody != nil {
+		body, err := xml.Marshal(r.RequestBody)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(append([]byte(xml.Header), body...))
+	}
+
+	raw := &RawRequestBuilder{
+		RequestMethod:       r.RequestMethod,
+		RequestHeader:       r.RequestHeader,
+		RequestURL:          r.RequestURL,
+		RequestURLTemplate:  r.RequestURLTemplate,
+		RequestURLVariables: r.RequestURLVariables,
+		RequestQuery:        r.RequestQuery,
+		RequestBody:         reader,
+		DefaultContentType:  "application/xml",
 	}
 	return raw.BuildRequest()
 }
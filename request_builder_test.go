@@ -6,6 +6,8 @@ import (
 	"net/url"
 	"strings"
 	"testing"
+
+	"github.com/google/go-cmp/cmp"
 )
 
 func mustParseURL(s string) *url.URL {
@@ -121,6 +123,34 @@ func TestRawRequestBuilder(t *testing.T) {
 		})
 	})
 
+	t.Run("Multi-valued Header", func(t *testing.T) {
+		header := http.Header{
+			"accept": {"application/json", "text/plain"},
+			"Via":    {"1.0 fred", "1.1 example.com"},
+		}
+		header.Add("X-Custom", "foo")
+		header.Add("X-Custom", "bar")
+		r := &RawRequestBuilder{
+			RequestMethod: http.MethodGet,
+			RequestHeader: header,
+			RequestURL:    url,
+		}
+
+		req, err := r.BuildRequest()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := http.Header{
+			"Accept":   {"application/json", "text/plain"},
+			"Via":      {"1.0 fred", "1.1 example.com"},
+			"X-Custom": {"foo", "bar"},
+		}
+		if diff := cmp.Diff(req.Header, expected); diff != "" {
+			t.Errorf("Should no diff, but got: %s", diff)
+		}
+	})
+
 	t.Run("Error", func(t *testing.T) {
 		r := &RawRequestBuilder{
 			RequestMethod: "INVALID!@#$%^&**()_+|-=\\`~",
@@ -254,7 +284,75 @@ func TestJSONRequestBuilder(t *testing.T) {
 			RequestMethod: http.MethodPost,
 			RequestHeader: header,
 			RequestURL:    url,
-			RequestBody:   map[struct{}]struct{}{}, // invalid
+			RequestBody:   map[struct{}]struct{}{{}: {}}, // invalid
+		}
+
+		req, err := r.BuildRequest()
+		if req != nil {
+			t.Errorf("Should be nil, but got: %v", req)
+		}
+		if err == nil {
+			t.Fatalf("Should not be nil")
+		}
+	})
+}
+
+func TestXMLRequestBuilder(t *testing.T) {
+	type Body struct {
+		XMLName struct{} `xml:"user"`
+		Name    string   `xml:"name"`
+	}
+
+	url := mustParseURL("http://localhost/")
+	t.Run("GET", func(t *testing.T) {
+		r := &XMLRequestBuilder{
+			RequestMethod: http.MethodGet,
+			RequestURL:    url,
+		}
+
+		req, err := r.BuildRequest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.Method != http.MethodGet {
+			t.Errorf("Should got GET method, but got: %s", req.Method)
+		}
+		if req.URL.String() != url.String() {
+			t.Errorf("Should equals with %s, but got: %s", url, req.URL)
+		}
+	})
+
+	t.Run("POST", func(t *testing.T) {
+		r := &XMLRequestBuilder{
+			RequestMethod: http.MethodPost,
+			RequestURL:    url,
+			RequestBody:   &Body{Name: "karupa"},
+		}
+
+		req, err := r.BuildRequest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.Method != http.MethodPost {
+			t.Errorf("Should got POST method, but got: %s", req.Method)
+		}
+		if s := req.Header.Get("Content-Type"); s != "application/xml" {
+			t.Errorf("Should be application/xml, but got: %s", s)
+		}
+		const expected = `<?xml version="1.0" encoding="UTF-8"?>` + "\n" + `<user><name>karupa</name></user>`
+		if req.ContentLength != int64(len(expected)) {
+			t.Errorf("Should be %d, but got: %d", len(expected), req.ContentLength)
+		}
+		if body, err := ioutil.ReadAll(req.Body); string(body) != expected || err != nil {
+			t.Errorf("Should be %s, but got: %s, error: %v", expected, string(body), err)
+		}
+	})
+
+	t.Run("Error", func(t *testing.T) {
+		r := &XMLRequestBuilder{
+			RequestMethod: http.MethodPost,
+			RequestURL:    url,
+			RequestBody:   make(chan int), // invalid
 		}
 
 		req, err := r.BuildRequest()
@@ -3,11 +3,14 @@ package httpflow
 import (
 	"bytes"
 	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"mime"
 	"net/http"
 	"net/url"
-	"strings"
+	"time"
 
 	"golang.org/x/text/encoding"
 	"golang.org/x/text/encoding/ianaindex"
@@ -33,6 +36,9 @@ func (h *RawResponseHandler) HandleResponse(res *http.Response) error {
 type NobodyResponseHandler struct {
 	RawResponseHandler
 	expectedStatusCodes []int
+	expectations        []func(StatusCode) bool
+	statusCallbacks     map[int]func(*http.Response) error
+	statusHandled       bool
 	StatusCode
 	Header http.Header
 }
@@ -43,33 +49,99 @@ func (h *NobodyResponseHandler) ExpectStatusCode(statusCodes ...int) {
 	h.expectedStatusCodes = append(h.expectedStatusCodes, statusCodes...)
 }
 
+// ExpectSuccessful expects any 2xx status code.
+func (h *NobodyResponseHandler) ExpectSuccessful() {
+	h.ExpectFunc(StatusCode.IsSuccessful)
+}
+
+// ExpectRange expects the status code between min and max inclusive.
+func (h *NobodyResponseHandler) ExpectRange(min, max int) {
+	h.ExpectFunc(func(c StatusCode) bool {
+		return StatusCode(min) <= c && c <= StatusCode(max)
+	})
+}
+
+// ExpectFunc expects the status code which the function reports true for.
+// The response is expected if any of the expectations is satisfied.
+func (h *NobodyResponseHandler) ExpectFunc(fn func(StatusCode) bool) {
+	h.expectations = append(h.expectations, fn)
+}
+
+// OnStatus sets the callback for the status code. The callback handles the response instead of the expectations,
+// and its result is the result of HandleResponse. e.g. h.OnStatus(404, func(*http.Response) error { return nil })
+func (h *NobodyResponseHandler) OnStatus(statusCode int, fn func(*http.Response) error) {
+	if h.statusCallbacks == nil {
+		h.statusCallbacks = map[int]func(*http.Response) error{}
+	}
+	h.statusCallbacks[statusCode] = fn
+}
+
+// StatusHandled reports whether the last response was handled by the callback set by OnStatus.
+func (h *NobodyResponseHandler) StatusHandled() bool {
+	return h.statusHandled
+}
+
+func (h *NobodyResponseHandler) isExpectedStatusCode(statusCode StatusCode) bool {
+	if h.expectedStatusCodes == nil && h.expectations == nil {
+		return true
+	}
+	for _, expected := range h.expectedStatusCodes {
+		if int(statusCode) == expected {
+			return true
+		}
+	}
+	for _, fn := range h.expectations {
+		if fn(statusCode) {
+			return true
+		}
+	}
+	return false
+}
+
+func (h *NobodyResponseHandler) RetryAfter() (time.Duration, bool) {
+	return retryAfterFromHeader(h.Header, time.Now())
+}
+
+func (h *NobodyResponseHandler) RateLimitRemaining() (int, bool) {
+	return rateLimitRemainingFromHeader(h.Header)
+}
+
+func (h *NobodyResponseHandler) RateLimitReset() (time.Time, bool) {
+	return rateLimitResetFromHeader(h.Header, time.Now())
+}
+
 func (h *NobodyResponseHandler) HandleResponse(res *http.Response) error {
 	h.StatusCode = StatusCode(res.StatusCode)
 	h.Header = res.Header
 	h.RawResponseHandler.HandleResponse(res) // always be nil
 
-	if h.expectedStatusCodes != nil {
-		ok := false
-		for _, statusCode := range h.expectedStatusCodes {
-			if res.StatusCode == statusCode {
-				ok = true
-				break
-			}
-		}
-		if !ok {
-			return &UnexpectedStatusCodeError{StatusCode: h.StatusCode}
-		}
+	if fn, ok := h.statusCallbacks[res.StatusCode]; ok {
+		h.statusHandled = true
+		return fn(res)
+	}
+	h.statusHandled = false
+
+	if !h.isExpectedStatusCode(h.StatusCode) {
+		return &UnexpectedStatusCodeError{StatusCode: h.StatusCode}
 	}
 	return nil
 }
 
 type BinaryResponseHandler struct {
 	NobodyResponseHandler
-	body []byte
+	body         []byte
+	newErrorBody func() error
 }
 
 var _ ResponseHandler = &BinaryResponseHandler{}
 
+// ExpectErrorBody sets the factory of the error to decode the body into on the unexpected non-2xx status code.
+// The body is decoded by the codec for Content-Type in DefaultCodecRegistry, and the error is set to UnexpectedStatusCodeError.Err.
+// e.g. h.ExpectErrorBody(func() error { return &MyAPIError{} })
+func (h *BinaryResponseHandler) ExpectErrorBody(newError func() error) {
+	h.newErrorBody = newError
+}
+
 func (h *BinaryResponseHandler) HandleResponse(res *http.Response) (err error) {
 	rawBody := res.Body
 	defer rawBody.Close()
@@ -83,10 +155,29 @@ func (h *BinaryResponseHandler) HandleResponse(res *http.Response) (err error) {
 	err = h.NobodyResponseHandler.HandleResponse(res)
 	if uerr, ok := err.(*UnexpectedStatusCodeError); ok {
 		uerr.Body = h.body
+		uerr.Err = h.decodeErrorBody()
 	}
 	return
 }
 
+// decodeErrorBody returns the error decoded from the body, or falls back to the problem details.
+func (h *BinaryResponseHandler) decodeErrorBody() error {
+	if h.newErrorBody != nil && !h.StatusCode.IsSuccessful() {
+		if codec, ok := DefaultCodecRegistry.Lookup(ParseMediaType(h.Header)); ok {
+			errBody := h.newErrorBody()
+			if err := codec.Unmarshal(h.body, errBody); err == nil {
+				return errBody
+			}
+		}
+	}
+	if h.IsProblem() {
+		if problem, err := h.Problem(); err == nil {
+			return problem
+		}
+	}
+	return nil
+}
+
 func (h *BinaryResponseHandler) Bytes() []byte {
 	return h.body
 }
@@ -136,10 +227,7 @@ type JSONResponseHandler struct {
 var _ ResponseHandler = &JSONResponseHandler{}
 
 func (h *JSONResponseHandler) IsJSON() bool {
-	contentType := strings.TrimSpace(h.Header.Get(contentTypeHeaderName))
-	parts := strings.SplitN(contentType, ";", 2)
-	mediatype := parts[0]
-	return mediatype == "application/json" || strings.HasPrefix(mediatype, "application/json+") || (strings.HasPrefix(mediatype, "application/") && strings.HasSuffix(mediatype, "+json"))
+	return IsJSONMediaType(ParseMediaType(h.Header))
 }
 
 func (h *JSONResponseHandler) GetDecoder() *json.Decoder {
@@ -174,10 +262,7 @@ type FormResponseHandler struct {
 var _ ResponseHandler = &FormResponseHandler{}
 
 func (h *FormResponseHandler) IsForm() bool {
-	contentType := strings.TrimSpace(h.Header.Get(contentTypeHeaderName))
-	parts := strings.SplitN(contentType, ";", 2)
-	mediatype := parts[0]
-	return mediatype == "application/x-www-form-urlencoded"
+	return MatchMediaType(ParseMediaType(h.Header), formMediaTypes)
 }
 
 func (h *FormResponseHandler) ParseForm() (url.Values, error) {
@@ -193,3 +278,65 @@ func (h *FormResponseHandler) ParseForm() (url.Values, error) {
 	body := h.String()
 	return url.ParseQuery(body)
 }
+
+type XMLResponseHandler struct {
+	StringResponseHandler
+}
+
+var _ ResponseHandler = &XMLResponseHandler{}
+
+func (h *XMLResponseHandler) IsXML() bool {
+	return MatchMediaType(ParseMediaType(h.Header), xmlMediaTypes)
+}
+
+// GetDecoder returns the decoder which respects the charset in Content-Type header,
+// or the encoding declared in the XML prolog if the header has no charset.
+func (h *XMLResponseHandler) GetDecoder() (*xml.Decoder, error) {
+	var reader io.Reader = bytes.NewReader(h.Bytes())
+
+	var enc encoding.Encoding
+	if h.Header.Get(contentTypeHeaderName) != "" {
+		var err error
+		enc, err = h.GetEncoding()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if enc != nil {
+		reader = enc.NewDecoder().Reader(reader)
+	}
+
+	decoder := xml.NewDecoder(reader)
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		if enc != nil {
+			// already decoded by the charset in the header
+			return input, nil
+		}
+
+		e, err := ianaindex.MIME.Encoding(charset)
+		if err != nil {
+			return nil, err
+		}
+		if e == nil {
+			return nil, fmt.Errorf("unsupported charset: %s", charset)
+		}
+		return e.NewDecoder().Reader(input), nil
+	}
+	return decoder, nil
+}
+
+func (h *XMLResponseHandler) DecodeXML(v interface{}) error {
+	if !h.IsXML() {
+		return &UnexpectedContentTypeError{
+			ContentType: h.Header.Get(contentTypeHeaderName),
+			Body:        h.Bytes(),
+		}
+	}
+
+	decoder, err := h.GetDecoder()
+	if err != nil {
+		return err
+	}
+	return decoder.Decode(v)
+}
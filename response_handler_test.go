@@ -31,7 +31,7 @@ func TestRawResponseHandler(t *testing.T) {
 	}
 
 	if handler.RawResponse != res {
-		t.Errorf("Should be same pointer, but got: %d", handler.RawResponse)
+		t.Errorf("Should be same pointer, but got: %v", handler.RawResponse)
 	}
 }
 
@@ -85,6 +85,84 @@ func TestNobodyResponseHandler(t *testing.T) {
 			}
 		})
 	})
+
+	t.Run("ExpectFunc", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			expect   func(h *NobodyResponseHandler)
+			expected map[int]bool
+		}{
+			"ExpectSuccessful": {
+				expect:   func(h *NobodyResponseHandler) { h.ExpectSuccessful() },
+				expected: map[int]bool{200: true, 204: true, 299: true, 199: false, 301: false, 500: false},
+			},
+			"ExpectRange": {
+				expect:   func(h *NobodyResponseHandler) { h.ExpectRange(400, 404) },
+				expected: map[int]bool{400: true, 404: true, 200: false, 405: false},
+			},
+			"ExpectFunc": {
+				expect: func(h *NobodyResponseHandler) {
+					h.ExpectFunc(func(c StatusCode) bool { return c.IsSuccessful() && c != 204 })
+				},
+				expected: map[int]bool{200: true, 201: true, 204: false, 500: false},
+			},
+			"Union": {
+				expect: func(h *NobodyResponseHandler) {
+					h.ExpectStatusCode(304)
+					h.ExpectSuccessful()
+				},
+				expected: map[int]bool{200: true, 304: true, 302: false},
+			},
+		} {
+			t.Run(name, func(t *testing.T) {
+				for statusCode, expected := range tc.expected {
+					handler := &NobodyResponseHandler{}
+					tc.expect(handler)
+					err := handler.HandleResponse(&http.Response{StatusCode: statusCode})
+					if expected && err != nil {
+						t.Errorf("%d: Should be expected, but got: %v", statusCode, err)
+					} else if !expected {
+						if _, ok := err.(*UnexpectedStatusCodeError); !ok {
+							t.Errorf("%d: Should be UnexpectedStatusCodeError, but got: %v", statusCode, err)
+						}
+					}
+				}
+			})
+		}
+	})
+
+	t.Run("OnStatus", func(t *testing.T) {
+		const msg = "MOCK CALLBACK ERROR DAYO"
+		handler := &NobodyResponseHandler{}
+		handler.ExpectSuccessful()
+		handler.OnStatus(404, func(res *http.Response) error {
+			return nil
+		})
+		handler.OnStatus(409, func(res *http.Response) error {
+			return errors.New(msg)
+		})
+
+		if err := handler.HandleResponse(&http.Response{StatusCode: 404}); err != nil {
+			t.Errorf("Should be nil, but got: %v", err)
+		}
+		if !handler.StatusHandled() {
+			t.Error("Should be handled by the callback")
+		}
+
+		if err := handler.HandleResponse(&http.Response{StatusCode: 409}); err == nil || err.Error() != msg {
+			t.Errorf("Should be %s, but got: %v", msg, err)
+		}
+
+		if err := handler.HandleResponse(&http.Response{StatusCode: 200}); err != nil {
+			t.Errorf("Should be nil, but got: %v", err)
+		}
+		if handler.StatusHandled() {
+			t.Error("Should not be handled by the callback")
+		}
+
+		if _, ok := handler.HandleResponse(&http.Response{StatusCode: 500}).(*UnexpectedStatusCodeError); !ok {
+			t.Error("Should be UnexpectedStatusCodeError")
+		}
+	})
 }
 
 func TestBinaryResponseHandler(t *testing.T) {
@@ -114,6 +192,64 @@ func TestBinaryResponseHandler(t *testing.T) {
 			t.Error(err)
 		}
 	})
+
+	t.Run("ExpectErrorBody", func(t *testing.T) {
+		newResponse := func(statusCode int, contentType, body string) *http.Response {
+			return &http.Response{
+				StatusCode: statusCode,
+				Header:     http.Header{"Content-Type": {contentType}},
+				Body:       ioutil.NopCloser(strings.NewReader(body)),
+			}
+		}
+		newHandler := func() *BinaryResponseHandler {
+			handler := &BinaryResponseHandler{}
+			handler.ExpectStatusCode(200)
+			handler.ExpectErrorBody(func() error { return &mockAPIError{} })
+			return handler
+		}
+
+		err := newHandler().HandleResponse(newResponse(400, "application/json", `{"code":"invalid","message":"invalid name"}`))
+		var apiErr *mockAPIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("Should be mockAPIError, but got: %v", err)
+		}
+		if diff := cmp.Diff(&mockAPIError{Code: "invalid", Message: "invalid name"}, apiErr); diff != "" {
+			t.Errorf("Unexpected error body: %s", diff)
+		}
+		var uerr *UnexpectedStatusCodeError
+		if !errors.As(err, &uerr) {
+			t.Fatalf("Should be UnexpectedStatusCodeError, but got: %v", err)
+		} else if uerr.StatusCode != 400 {
+			t.Errorf("Should be 400, but got: %d", uerr.StatusCode)
+		}
+
+		err = newHandler().HandleResponse(newResponse(201, "application/json", `{"code":"created"}`))
+		if errors.As(err, &apiErr) {
+			t.Errorf("Should not decode the successful response, but got: %v", apiErr)
+		}
+
+		err = newHandler().HandleResponse(newResponse(500, "text/html", `<html></html>`))
+		if errors.As(err, &apiErr) {
+			t.Errorf("Should not decode the unknown content type, but got: %v", apiErr)
+		}
+
+		err = newHandler().HandleResponse(newResponse(500, "application/json", `{`))
+		if errors.As(err, &apiErr) {
+			t.Errorf("Should not decode the broken body, but got: %v", apiErr)
+		}
+		if !errors.As(err, &uerr) {
+			t.Fatalf("Should be UnexpectedStatusCodeError, but got: %v", err)
+		}
+	})
+}
+
+type mockAPIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *mockAPIError) Error() string {
+	return e.Code + ": " + e.Message
 }
 
 func mustEncodeString(e encoding.Encoding, src string) string {
@@ -364,6 +500,22 @@ func TestJSONResponseHandler(t *testing.T) {
 			}
 		})
 
+		t.Run("text/foo+json", func(t *testing.T) {
+			res := &http.Response{
+				Header: http.Header{"Content-Type": {"text/foo+json"}},
+				Body:   ioutil.NopCloser(strings.NewReader(`{"dummy":"dummy"}`)),
+			}
+			handler := &JSONResponseHandler{}
+			err := handler.HandleResponse(res)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if handler.IsJSON() {
+				t.Error("Should not be detected as json")
+			}
+		})
+
 		t.Run("text/html", func(t *testing.T) {
 			res := &http.Response{
 				Header: http.Header{"Content-Type": {"text/html"}},
@@ -434,3 +586,94 @@ func TestFormResponseHandler(t *testing.T) {
 		}
 	})
 }
+
+func TestXMLResponseHandler(t *testing.T) {
+	type Body struct {
+		Name string `xml:"name"`
+	}
+
+	t.Run("DecodeXML()", func(t *testing.T) {
+		for contentType, body := range map[string]string{
+			"application/xml":                    `<?xml version="1.0"?><user><name>かつを</name></user>`,
+			"text/xml; charset=utf-8":            `<user><name>かつを</name></user>`,
+			"application/atom+xml":               `<user><name>かつを</name></user>`,
+			"image/svg+xml":                      `<user><name>かつを</name></user>`,
+			"application/xml; charset=Shift_JIS": mustEncodeString(japanese.ShiftJIS, `<?xml version="1.0" encoding="Shift_JIS"?><user><name>かつを</name></user>`),
+			"application/xml; charset=EUC-JP":    mustEncodeString(japanese.EUCJP, `<?xml version="1.0" encoding="Shift_JIS"?><user><name>かつを</name></user>`),
+			"application/soap+xml":               mustEncodeString(japanese.ShiftJIS, `<?xml version="1.0" encoding="Shift_JIS"?><user><name>かつを</name></user>`),
+		} {
+			t.Run(contentType, func(t *testing.T) {
+				res := &http.Response{
+					Header: http.Header{"Content-Type": {contentType}},
+					Body:   ioutil.NopCloser(strings.NewReader(body)),
+				}
+				handler := &XMLResponseHandler{}
+				err := handler.HandleResponse(res)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !handler.IsXML() {
+					t.Error("Should be detected as xml")
+				}
+
+				var body Body
+				err = handler.DecodeXML(&body)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if body.Name != "かつを" {
+					t.Errorf("Should get かつを, but got: %s", body.Name)
+				}
+			})
+		}
+	})
+
+	t.Run("Unsupported Charset", func(t *testing.T) {
+		for contentType, body := range map[string]string{
+			"application/xml; charset=invalid-charset": `<user><name>naiyo</name></user>`,
+			"application/xml":                          `<?xml version="1.0" encoding="invalid-charset"?><user><name>naiyo</name></user>`,
+		} {
+			res := &http.Response{
+				Header: http.Header{"Content-Type": {contentType}},
+				Body:   ioutil.NopCloser(strings.NewReader(body)),
+			}
+			handler := &XMLResponseHandler{}
+			err := handler.HandleResponse(res)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var body Body
+			if err := handler.DecodeXML(&body); err == nil {
+				t.Errorf("%s: Should not be nil", contentType)
+			}
+		}
+	})
+
+	t.Run("UnexpectedContentType", func(t *testing.T) {
+		for _, contentType := range []string{"text/plain", "application/json", "application/xml-dtd"} {
+			res := &http.Response{
+				Header: http.Header{"Content-Type": {contentType}},
+				Body:   ioutil.NopCloser(strings.NewReader(`<user><name>naiyo</name></user>`)),
+			}
+			handler := &XMLResponseHandler{}
+			err := handler.HandleResponse(res)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if handler.IsXML() {
+				t.Errorf("%s: Should not be detected as xml", contentType)
+			}
+
+			var body Body
+			err = handler.DecodeXML(&body)
+			if subErr, ok := err.(*UnexpectedContentTypeError); !ok {
+				t.Error(err)
+			} else if subErr.ContentType != contentType {
+				t.Errorf("Should get %s, but got: %s", contentType, subErr.ContentType)
+			}
+		}
+	})
+}
@@ -0,0 +1,221 @@
+package httpflow
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var DefaultRetryableStatusCodes = []int{
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// RetryPolicy configures how Agent retries a session.
+// Every attempt rebuilds the request by the session's BuildRequest,
+// and only the response of the last attempt is passed to its HandleResponse.
+type RetryPolicy struct {
+	// MaxAttempts is the number of attempts including the first one.
+	MaxAttempts int
+
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+	// Multiplier defaults to 2.
+	Multiplier float64
+	// Jitter is the ratio (0.0-1.0) of the backoff to be randomly subtracted.
+	Jitter float64
+
+	// MaxRetryAfter is the longest Retry-After to wait for. The response is not retried if it requests longer.
+	// It defaults to MaxBackoff, or DefaultMaxRetryAfter if MaxBackoff is zero.
+	MaxRetryAfter time.Duration
+
+	// RetryableStatusCodes defaults to DefaultRetryableStatusCodes.
+	RetryableStatusCodes []int
+	// IsRetryableError defaults to IsTransientError.
+	IsRetryableError func(error) bool
+	// RetryNonIdempotent retries the non-idempotent requests on the transport errors and the retryable status codes.
+	// By default, they are retried only if the method is idempotent or the request has Idempotency-Key header,
+	// because the server may have already applied the request.
+	RetryNonIdempotent bool
+}
+
+const DefaultMaxRetryAfter = time.Minute
+
+func (p *RetryPolicy) canRetry(attempt int, req *http.Request) bool {
+	if p == nil || attempt >= p.MaxAttempts {
+		return false
+	}
+	return req.Context().Err() == nil
+}
+
+func (p *RetryPolicy) canRetryRequest(req *http.Request) bool {
+	return p.RetryNonIdempotent || isIdempotentRequest(req)
+}
+
+func isIdempotentRequest(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != "" || req.Header.Get("X-Idempotency-Key") != ""
+}
+
+func (p *RetryPolicy) maxRetryAfter() time.Duration {
+	if p.MaxRetryAfter > 0 {
+		return p.MaxRetryAfter
+	}
+	if p.MaxBackoff > 0 {
+		return p.MaxBackoff
+	}
+	return DefaultMaxRetryAfter
+}
+
+func (p *RetryPolicy) isRetryableError(err error) bool {
+	if p.IsRetryableError != nil {
+		return p.IsRetryableError(err)
+	}
+	return IsTransientError(err)
+}
+
+func (p *RetryPolicy) isRetryableStatusCode(statusCode int) bool {
+	statusCodes := p.RetryableStatusCodes
+	if statusCodes == nil {
+		statusCodes = DefaultRetryableStatusCodes
+	}
+	for _, retryable := range statusCodes {
+		if statusCode == retryable {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+
+	backoff := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxBackoff > 0 && backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		backoff -= backoff * math.Min(p.Jitter, 1) * rand.Float64()
+	}
+	return time.Duration(backoff)
+}
+
+func IsTransientError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+type roundTripAttempt struct {
+	client  HTTPClient
+	policy  *RetryPolicy
+	attempt int
+	retry   bool
+	wait    time.Duration
+	handled bool
+}
+
+func (t *roundTripAttempt) phase() SessionPhase {
+	if t.handled {
+		return SessionPhaseHandle
+	}
+	return SessionPhaseTransport
+}
+
+func (t *roundTripAttempt) roundTrip(session Session, req *http.Request) (*http.Response, error) {
+	res, err := t.client.Do(req)
+	if err != nil {
+		if t.policy.canRetry(t.attempt, req) && t.policy.canRetryRequest(req) && t.policy.isRetryableError(err) {
+			t.retry = true
+			t.wait = t.policy.backoff(t.attempt)
+		}
+		return nil, err
+	}
+
+	if t.policy.canRetry(t.attempt, req) && t.policy.canRetryRequest(req) && t.policy.isRetryableStatusCode(res.StatusCode) {
+		wait := t.policy.backoff(t.attempt)
+		if retryAfter, ok := parseRetryAfter(res.Header.Get("Retry-After"), time.Now()); ok && retryAfter > wait {
+			wait = retryAfter
+		}
+
+		// give up rather than blocking the caller for too long
+		if wait <= t.policy.maxRetryAfter() {
+			t.retry = true
+			t.wait = wait
+			discardBody(res)
+			return res, &UnexpectedStatusCodeError{StatusCode: StatusCode(res.StatusCode)}
+		}
+	}
+
+	t.handled = true
+	return res, session.HandleResponse(res)
+}
+
+func discardBody(res *http.Response) {
+	if res.Body == nil {
+		return
+	}
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 4096))
+	res.Body.Close()
+}
+
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.ParseUint(value, 10, 32); err == nil {
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+	if wait := date.Sub(now); wait > 0 {
+		return wait, true
+	}
+	return 0, true
+}
+
+func sleepContext(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
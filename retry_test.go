@@ -0,0 +1,355 @@
+package httpflow
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type mockSequenceClient struct {
+	responses []mockResponse
+	errors    []error
+	requests  []*http.Request
+}
+
+func (c *mockSequenceClient) Do(req *http.Request) (*http.Response, error) {
+	i := len(c.requests)
+	c.requests = append(c.requests, req)
+	if i < len(c.errors) && c.errors[i] != nil {
+		return nil, c.errors[i]
+	}
+	return c.responses[i].MockResponse(req), nil
+}
+
+func newRetryTestSession(t *testing.T) *mockSession {
+	req, err := http.NewRequest(http.MethodGet, "http://example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &mockSession{request: req}
+}
+
+func TestAgentRetryPolicy(t *testing.T) {
+	policy := &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond}
+
+	t.Run("Retry Status Code", func(t *testing.T) {
+		client := &mockSequenceClient{responses: []mockResponse{
+			{statusCode: 503},
+			{statusCode: 502},
+			{statusCode: 200, body: []byte("ok")},
+		}}
+		agent := Agent{Client: client, RetryPolicy: policy}
+
+		session := newRetryTestSession(t)
+		err := agent.RunSession(session)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(client.requests) != 3 {
+			t.Errorf("Should send 3 times, but sent %d times", len(client.requests))
+		}
+		if session.buildreq != 3 {
+			t.Errorf("Should called 3 times, but called %d times", session.buildreq)
+		}
+		if session.handleres != 1 {
+			t.Errorf("Should called once, but called %d times", session.handleres)
+		}
+		if session.response.StatusCode != 200 {
+			t.Errorf("Should be 200, but got: %d", session.response.StatusCode)
+		}
+	})
+
+	t.Run("Give Up", func(t *testing.T) {
+		client := &mockSequenceClient{responses: []mockResponse{
+			{statusCode: 503},
+			{statusCode: 503},
+			{statusCode: 503},
+		}}
+		agent := Agent{Client: client, RetryPolicy: policy}
+
+		session := newRetryTestSession(t)
+		err := agent.RunSession(session)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(client.requests) != 3 {
+			t.Errorf("Should send 3 times, but sent %d times", len(client.requests))
+		}
+		if session.handleres != 1 {
+			t.Errorf("Should called once, but called %d times", session.handleres)
+		}
+		if session.response.StatusCode != 503 {
+			t.Errorf("Should be 503, but got: %d", session.response.StatusCode)
+		}
+	})
+
+	t.Run("Not Retryable Status Code", func(t *testing.T) {
+		client := &mockSequenceClient{responses: []mockResponse{
+			{statusCode: 500},
+		}}
+		agent := Agent{Client: client, RetryPolicy: policy}
+
+		session := newRetryTestSession(t)
+		err := agent.RunSession(session)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(client.requests) != 1 {
+			t.Errorf("Should send once, but sent %d times", len(client.requests))
+		}
+	})
+
+	t.Run("Retry Transport Error", func(t *testing.T) {
+		client := &mockSequenceClient{
+			responses: []mockResponse{{}, {statusCode: 200}},
+			errors:    []error{syscall.ECONNRESET},
+		}
+		agent := Agent{Client: client, RetryPolicy: policy}
+
+		session := newRetryTestSession(t)
+		err := agent.RunSession(session)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(client.requests) != 2 {
+			t.Errorf("Should send 2 times, but sent %d times", len(client.requests))
+		}
+	})
+
+	t.Run("Give Up Transport Error", func(t *testing.T) {
+		client := &mockSequenceClient{
+			responses: []mockResponse{{}, {}, {}},
+			errors:    []error{syscall.ECONNRESET, syscall.ECONNRESET, syscall.ECONNRESET},
+		}
+		agent := Agent{Client: client, RetryPolicy: policy}
+
+		session := newRetryTestSession(t)
+		err := agent.RunSession(session)
+		var serr *SessionError
+		if !errors.As(err, &serr) {
+			t.Fatalf("Should be SessionError, but got: %v", err)
+		}
+		if serr.Attempt != 3 {
+			t.Errorf("Should be 3rd attempt, but got: %d", serr.Attempt)
+		}
+		if serr.Phase != SessionPhaseTransport {
+			t.Errorf("Should be transport, but got: %s", serr.Phase)
+		}
+		if !errors.Is(err, syscall.ECONNRESET) {
+			t.Errorf("Should be ECONNRESET, but got: %v", err)
+		}
+	})
+
+	t.Run("Not Retryable Transport Error", func(t *testing.T) {
+		const msg = "MOCK REQUEST ERROR DAYO"
+		client := &mockSequenceClient{errors: []error{errors.New(msg)}}
+		agent := Agent{Client: client, RetryPolicy: policy}
+
+		session := newRetryTestSession(t)
+		err := agent.RunSession(session)
+		if err == nil || errors.Unwrap(err).Error() != msg {
+			t.Errorf("Should be %s, but got: %v", msg, err)
+		}
+
+		if len(client.requests) != 1 {
+			t.Errorf("Should send once, but sent %d times", len(client.requests))
+		}
+	})
+
+	t.Run("Retry-After", func(t *testing.T) {
+		client := &mockSequenceClient{responses: []mockResponse{
+			{statusCode: 503, headersMap: map[string]string{"Retry-After": "1"}},
+			{statusCode: 200},
+		}}
+		agent := Agent{Client: client, RetryPolicy: policy}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		session := newRetryTestSession(t)
+		err := agent.RunSessionCtx(ctx, session)
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Should be context.DeadlineExceeded, but got: %v", err)
+		}
+
+		if len(client.requests) != 1 {
+			t.Errorf("Should send once, but sent %d times", len(client.requests))
+		}
+		if session.handleres != 0 {
+			t.Errorf("Should not called, but called %d times", session.handleres)
+		}
+	})
+
+	t.Run("Too Long Retry-After", func(t *testing.T) {
+		client := &mockSequenceClient{responses: []mockResponse{
+			{statusCode: 503, headersMap: map[string]string{"Retry-After": "86400"}},
+			{statusCode: 200},
+		}}
+		agent := Agent{Client: client, RetryPolicy: &RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxRetryAfter: time.Second}}
+
+		session := newRetryTestSession(t)
+		if err := agent.RunSession(session); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(client.requests) != 1 {
+			t.Errorf("Should send once, but sent %d times", len(client.requests))
+		}
+		if session.response.StatusCode != 503 {
+			t.Errorf("Should be 503, but got: %d", session.response.StatusCode)
+		}
+	})
+
+	t.Run("Non-Idempotent Transport Error", func(t *testing.T) {
+		for name, tc := range map[string]struct {
+			policy   *RetryPolicy
+			header   http.Header
+			requests int
+		}{
+			"Default":            {policy, nil, 1},
+			"Idempotency-Key":    {policy, http.Header{"Idempotency-Key": {"abc"}}, 2},
+			"RetryNonIdempotent": {&RetryPolicy{MaxAttempts: 3, InitialBackoff: time.Millisecond, RetryNonIdempotent: true}, nil, 2},
+		} {
+			t.Run(name, func(t *testing.T) {
+				client := &mockSequenceClient{
+					responses: []mockResponse{{}, {statusCode: 200}},
+					errors:    []error{syscall.ECONNRESET},
+				}
+				agent := Agent{Client: client, RetryPolicy: tc.policy}
+
+				req, err := http.NewRequest(http.MethodPost, "http://example.com/", nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for name, values := range tc.header {
+					req.Header[name] = values
+				}
+
+				err = agent.RunSession(&mockSession{request: req})
+				if tc.requests == 1 && !errors.Is(err, syscall.ECONNRESET) {
+					t.Errorf("Should be ECONNRESET, but got: %v", err)
+				} else if tc.requests != 1 && err != nil {
+					t.Error(err)
+				}
+				if len(client.requests) != tc.requests {
+					t.Errorf("Should send %d times, but sent %d times", tc.requests, len(client.requests))
+				}
+			})
+		}
+	})
+
+	t.Run("Non-Idempotent Status Code", func(t *testing.T) {
+		client := &mockSequenceClient{responses: []mockResponse{
+			{statusCode: 504},
+			{statusCode: 200},
+		}}
+		agent := Agent{Client: client, RetryPolicy: policy}
+
+		req, err := http.NewRequest(http.MethodPost, "http://example.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		session := &mockSession{request: req}
+		if err := agent.RunSession(session); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(client.requests) != 1 {
+			t.Errorf("Should send once, but sent %d times", len(client.requests))
+		}
+		if session.response.StatusCode != 504 {
+			t.Errorf("Should be 504, but got: %d", session.response.StatusCode)
+		}
+	})
+
+	t.Run("Middleware", func(t *testing.T) {
+		client := &mockSequenceClient{responses: []mockResponse{
+			{statusCode: 503},
+			{statusCode: 200},
+		}}
+		agent := Agent{Client: client, RetryPolicy: policy}
+
+		var errs []error
+		agent.Use(func(next RoundTripFunc) RoundTripFunc {
+			return func(session Session, req *http.Request) (*http.Response, error) {
+				res, err := next(session, req)
+				errs = append(errs, err)
+				return res, err
+			}
+		})
+
+		session := newRetryTestSession(t)
+		err := agent.RunSession(session)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(errs) != 2 {
+			t.Fatalf("Should called 2 times, but called %d times", len(errs))
+		}
+		if uerr, ok := errs[0].(*UnexpectedStatusCodeError); !ok || uerr.StatusCode != 503 {
+			t.Errorf("Should be UnexpectedStatusCodeError with 503, but got: %v", errs[0])
+		}
+		if errs[1] != nil {
+			t.Errorf("Should be nil, but got: %v", errs[1])
+		}
+	})
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := &RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond}
+	for attempt, expected := range []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 300 * time.Millisecond, 300 * time.Millisecond} {
+		if d := policy.backoff(attempt + 1); d != expected {
+			t.Errorf("Should be %s, but got: %s", expected, d)
+		}
+	}
+
+	policy.Jitter = 0.5
+	for attempt := 1; attempt <= 10; attempt++ {
+		if d := policy.backoff(1); d < 50*time.Millisecond || 100*time.Millisecond < d {
+			t.Errorf("Should be between 50ms and 100ms, but got: %s", d)
+		}
+	}
+}
+
+func TestIsTransientError(t *testing.T) {
+	if !IsTransientError(syscall.ECONNRESET) {
+		t.Error("Should be true")
+	}
+	if !IsTransientError(io.ErrUnexpectedEOF) {
+		t.Error("Should be true")
+	}
+	if IsTransientError(context.Canceled) {
+		t.Error("Should be false")
+	}
+	if IsTransientError(errors.New("foo")) {
+		t.Error("Should be false")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2015, time.October, 21, 7, 28, 0, 0, time.UTC)
+	if d, ok := parseRetryAfter("120", now); !ok || d != 2*time.Minute {
+		t.Errorf("Should be 2m0s, but got: %s", d)
+	}
+	if d, ok := parseRetryAfter("Wed, 21 Oct 2015 07:29:00 GMT", now); !ok || d != time.Minute {
+		t.Errorf("Should be 1m0s, but got: %s", d)
+	}
+	if d, ok := parseRetryAfter("Wed, 21 Oct 2015 07:27:00 GMT", now); !ok || d != 0 {
+		t.Errorf("Should be 0s, but got: %s", d)
+	}
+	if _, ok := parseRetryAfter("", now); ok {
+		t.Error("Should be false")
+	}
+	if _, ok := parseRetryAfter("invalid", now); ok {
+		t.Error("Should be false")
+	}
+}
@@ -0,0 +1,93 @@
+package httpflow
+
+import "net/http"
+
+// StatusRoute is a branch of StatusRoutingResponseHandler.
+type StatusRoute struct {
+	Name string
+	// Match reports whether the route handles the status code. e.g. StatusCode.IsSuccessful
+	// The route never matches if it is nil.
+	Match func(StatusCode) bool
+	// Target is decoded from the body by the codec for Content-Type in DefaultCodecRegistry.
+	// The body is not decoded if it is empty (e.g. 204 No Content) or both of Target and Handler are nil.
+	Target interface{}
+	// Handler handles the response instead of decoding into Target if it is not nil.
+	Handler ResponseHandler
+}
+
+// StatusRoutingResponseHandler dispatches the response to the first route which matches the status code.
+// It returns UnexpectedStatusCodeError if no route matches.
+type StatusRoutingResponseHandler struct {
+	BinaryResponseHandler
+	Routes  []StatusRoute
+	matched *StatusRoute
+}
+
+var _ ResponseHandler = &StatusRoutingResponseHandler{}
+
+// Route adds the route to decode the body into the target.
+func (h *StatusRoutingResponseHandler) Route(name string, match func(StatusCode) bool, target interface{}) {
+	h.Routes = append(h.Routes, StatusRoute{Name: name, Match: match, Target: target})
+}
+
+// RouteStatus adds the route for the status code to decode the body into the target.
+func (h *StatusRoutingResponseHandler) RouteStatus(name string, statusCode int, target interface{}) {
+	h.Route(name, func(c StatusCode) bool { return int(c) == statusCode }, target)
+}
+
+// RouteHandler adds the route to let the sub-handler handle the response.
+func (h *StatusRoutingResponseHandler) RouteHandler(name string, match func(StatusCode) bool, handler ResponseHandler) {
+	h.Routes = append(h.Routes, StatusRoute{Name: name, Match: match, Handler: handler})
+}
+
+// Matched returns the name of the matched route and its Target, or Handler if Target is nil.
+// The name is empty if no route matched.
+func (h *StatusRoutingResponseHandler) Matched() (string, interface{}) {
+	if h.matched == nil {
+		return "", nil
+	}
+	if h.matched.Target != nil {
+		return h.matched.Name, h.matched.Target
+	}
+	return h.matched.Name, h.matched.Handler
+}
+
+func (h *StatusRoutingResponseHandler) HandleResponse(res *http.Response) error {
+	h.matched = nil
+	if err := h.BinaryResponseHandler.HandleResponse(res); err != nil {
+		return err
+	}
+	if h.StatusHandled() {
+		return nil
+	}
+
+	for i := range h.Routes {
+		if h.Routes[i].Match != nil && h.Routes[i].Match(h.StatusCode) {
+			h.matched = &h.Routes[i]
+			break
+		}
+	}
+	if h.matched == nil {
+		return &UnexpectedStatusCodeError{
+			StatusCode: h.StatusCode,
+			Body:       h.Bytes(),
+			Err:        h.decodeErrorBody(),
+		}
+	}
+
+	switch {
+	case h.matched.Handler != nil:
+		return h.matched.Handler.HandleResponse(res)
+	case h.matched.Target != nil && len(h.Bytes()) != 0:
+		codec, ok := DefaultCodecRegistry.Lookup(ParseMediaType(h.Header))
+		if !ok {
+			return &UnexpectedContentTypeError{
+				ContentType: h.Header.Get(contentTypeHeaderName),
+				Body:        h.Bytes(),
+			}
+		}
+		return codec.Unmarshal(h.Bytes(), h.matched.Target)
+	default:
+		return nil
+	}
+}
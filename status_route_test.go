@@ -0,0 +1,144 @@
+package httpflow
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStatusRoutingResponseHandler(t *testing.T) {
+	type created struct {
+		ID int `json:"id"`
+	}
+	type accepted struct {
+		JobID string `json:"job_id"`
+	}
+	type conflict struct {
+		Reason string `json:"reason"`
+	}
+
+	newHandler := func() *StatusRoutingResponseHandler {
+		handler := &StatusRoutingResponseHandler{}
+		handler.RouteStatus("created", 200, &created{})
+		handler.RouteStatus("accepted", 202, &accepted{})
+		handler.RouteStatus("no content", 204, nil)
+		handler.RouteStatus("conflict", 409, &conflict{})
+		handler.RouteHandler("redirect", StatusCode.IsRedirection, &NobodyResponseHandler{})
+		return handler
+	}
+
+	for _, tc := range []struct {
+		response mockResponse
+		name     string
+		value    interface{}
+	}{
+		{mockResponse{200, map[string]string{"Content-Type": "application/json"}, []byte(`{"id":1}`)}, "created", &created{ID: 1}},
+		{mockResponse{202, map[string]string{"Content-Type": "application/json"}, []byte(`{"job_id":"abc"}`)}, "accepted", &accepted{JobID: "abc"}},
+		{mockResponse{409, map[string]string{"Content-Type": "application/json"}, []byte(`{"reason":"exists"}`)}, "conflict", &conflict{Reason: "exists"}},
+		{mockResponse{204, nil, nil}, "no content", nil},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			handler := newHandler()
+			if err := handler.HandleResponse(tc.response.MockResponse(nil)); err != nil {
+				t.Fatal(err)
+			}
+
+			name, value := handler.Matched()
+			if name != tc.name {
+				t.Errorf("Should be %s, but got: %s", tc.name, name)
+			}
+			if diff := cmp.Diff(tc.value, value); diff != "" {
+				t.Errorf("Should no diff, but got: %s", diff)
+			}
+		})
+	}
+
+	t.Run("Handler", func(t *testing.T) {
+		handler := newHandler()
+		res := mockResponse{302, map[string]string{"Location": "/users/1"}, nil}.MockResponse(nil)
+		if err := handler.HandleResponse(res); err != nil {
+			t.Fatal(err)
+		}
+
+		name, value := handler.Matched()
+		if name != "redirect" {
+			t.Errorf("Should be redirect, but got: %s", name)
+		}
+		if sub, ok := value.(*NobodyResponseHandler); !ok {
+			t.Errorf("Should be the sub-handler, but got: %+v", value)
+		} else if s := sub.Header.Get("Location"); s != "/users/1" {
+			t.Errorf("Should be /users/1, but got: %s", s)
+		}
+	})
+
+	t.Run("No Route", func(t *testing.T) {
+		handler := newHandler()
+		handler.ExpectErrorBody(func() error { return &mockAPIError{} })
+		res := mockResponse{500, map[string]string{"Content-Type": "application/json"}, []byte(`{"code":"internal"}`)}.MockResponse(nil)
+		err := handler.HandleResponse(res)
+
+		var uerr *UnexpectedStatusCodeError
+		if !errors.As(err, &uerr) {
+			t.Fatalf("Should be UnexpectedStatusCodeError, but got: %v", err)
+		}
+		if string(uerr.Body) != `{"code":"internal"}` {
+			t.Errorf("Should keep body, but got: %s", string(uerr.Body))
+		}
+		var apiErr *mockAPIError
+		if !errors.As(err, &apiErr) || apiErr.Code != "internal" {
+			t.Errorf("Should be mockAPIError, but got: %v", err)
+		}
+		if name, value := handler.Matched(); name != "" || value != nil {
+			t.Errorf("Should not match, but got: %s, %v", name, value)
+		}
+	})
+
+	t.Run("UnexpectedContentType", func(t *testing.T) {
+		handler := newHandler()
+		res := mockResponse{200, map[string]string{"Content-Type": "text/html"}, []byte(`<html></html>`)}.MockResponse(nil)
+		err := handler.HandleResponse(res)
+		if _, ok := err.(*UnexpectedContentTypeError); !ok {
+			t.Errorf("Should be UnexpectedContentTypeError, but got: %v", err)
+		}
+	})
+
+	t.Run("Empty Body", func(t *testing.T) {
+		handler := newHandler()
+		res := mockResponse{202, nil, nil}.MockResponse(nil)
+		if err := handler.HandleResponse(res); err != nil {
+			t.Fatal(err)
+		}
+		if name, value := handler.Matched(); name != "accepted" || *value.(*accepted) != (accepted{}) {
+			t.Errorf("Should match accepted without decoding, but got: %s, %+v", name, value)
+		}
+	})
+
+	t.Run("Nil Match", func(t *testing.T) {
+		handler := &StatusRoutingResponseHandler{}
+		handler.Route("broken", nil, nil)
+		handler.RouteStatus("no content", 204, nil)
+		res := mockResponse{204, nil, nil}.MockResponse(nil)
+		if err := handler.HandleResponse(res); err != nil {
+			t.Fatal(err)
+		}
+		if name, _ := handler.Matched(); name != "no content" {
+			t.Errorf("Should skip the route without Match, but got: %s", name)
+		}
+	})
+
+	t.Run("Class", func(t *testing.T) {
+		var body struct {
+			OK bool `json:"ok"`
+		}
+		handler := &StatusRoutingResponseHandler{}
+		handler.Route("success", StatusCode.IsSuccessful, &body)
+		res := mockResponse{201, map[string]string{"Content-Type": "application/json"}, []byte(`{"ok":true}`)}.MockResponse(nil)
+		if err := handler.HandleResponse(res); err != nil {
+			t.Fatal(err)
+		}
+		if name, _ := handler.Matched(); name != "success" || !body.OK {
+			t.Errorf("Should be decoded by success, but got: %s, %+v", name, body)
+		}
+	})
+}
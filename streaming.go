@@ -0,0 +1,44 @@
+package httpflow
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// DefaultErrorBodyLimit is the default max bytes of the body read on the unexpected status code by StreamingResponseHandler.
+const DefaultErrorBodyLimit = 4096
+
+// StreamingResponseHandler passes the body to Stream without buffering it.
+// The body is always closed after HandleResponse returns.
+type StreamingResponseHandler struct {
+	NobodyResponseHandler
+	// Stream reads the body. It is not called on the unexpected status code, or if the callback set by OnStatus handled the response.
+	Stream func(body io.Reader) error
+	// ErrorBodyLimit is the max bytes of UnexpectedStatusCodeError.Body. It defaults to DefaultErrorBodyLimit.
+	ErrorBodyLimit int64
+}
+
+var _ ResponseHandler = &StreamingResponseHandler{}
+
+func (h *StreamingResponseHandler) HandleResponse(res *http.Response) error {
+	defer res.Body.Close()
+
+	err := h.NobodyResponseHandler.HandleResponse(res)
+	if uerr, ok := err.(*UnexpectedStatusCodeError); ok {
+		limit := h.ErrorBodyLimit
+		if limit <= 0 {
+			limit = DefaultErrorBodyLimit
+		}
+		uerr.Body, _ = ioutil.ReadAll(io.LimitReader(res.Body, limit))
+
+		prefix := &BinaryResponseHandler{NobodyResponseHandler: h.NobodyResponseHandler, body: uerr.Body}
+		uerr.Err = prefix.decodeErrorBody()
+		return uerr
+	}
+	if err != nil || h.StatusHandled() || h.Stream == nil {
+		return err
+	}
+
+	return h.Stream(res.Body)
+}
@@ -0,0 +1,137 @@
+package httpflow
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type mockCloseRecorder struct {
+	io.Reader
+	closed bool
+}
+
+func (r *mockCloseRecorder) Close() error {
+	r.closed = true
+	return nil
+}
+
+func TestStreamingResponseHandler(t *testing.T) {
+	newResponse := func(statusCode int, contentType string, body io.Reader) (*http.Response, *mockCloseRecorder) {
+		recorder := &mockCloseRecorder{Reader: body}
+		return &http.Response{
+			StatusCode: statusCode,
+			Header:     http.Header{"Content-Type": {contentType}},
+			Body:       recorder,
+		}, recorder
+	}
+
+	t.Run("Stream", func(t *testing.T) {
+		var buf bytes.Buffer
+		handler := &StreamingResponseHandler{
+			Stream: func(body io.Reader) error {
+				_, err := io.Copy(&buf, body)
+				return err
+			},
+		}
+		handler.ExpectSuccessful()
+
+		res, recorder := newResponse(200, "text/csv", strings.NewReader("a,b\n1,2\n"))
+		if err := handler.HandleResponse(res); err != nil {
+			t.Fatal(err)
+		}
+		if s := buf.String(); s != "a,b\n1,2\n" {
+			t.Errorf("Should be streamed, but got: %q", s)
+		}
+		if !recorder.closed {
+			t.Error("Should be closed")
+		}
+	})
+
+	t.Run("Stream Error", func(t *testing.T) {
+		const msg = "MOCK STREAM ERROR DAYO"
+		handler := &StreamingResponseHandler{
+			Stream: func(body io.Reader) error {
+				return errors.New(msg)
+			},
+		}
+
+		res, recorder := newResponse(200, "text/csv", strings.NewReader("a,b\n"))
+		if err := handler.HandleResponse(res); err == nil || err.Error() != msg {
+			t.Errorf("Should be %s, but got: %v", msg, err)
+		}
+		if !recorder.closed {
+			t.Error("Should be closed")
+		}
+	})
+
+	t.Run("Unexpected Status Code", func(t *testing.T) {
+		called := false
+		handler := &StreamingResponseHandler{
+			Stream: func(body io.Reader) error {
+				called = true
+				return nil
+			},
+			ErrorBodyLimit: 8,
+		}
+		handler.ExpectSuccessful()
+
+		res, recorder := newResponse(500, "text/plain", strings.NewReader(strings.Repeat("x", 1<<20)))
+		err := handler.HandleResponse(res)
+		var uerr *UnexpectedStatusCodeError
+		if !errors.As(err, &uerr) {
+			t.Fatalf("Should be UnexpectedStatusCodeError, but got: %v", err)
+		}
+		if string(uerr.Body) != "xxxxxxxx" {
+			t.Errorf("Should read only 8 bytes, but got: %d bytes", len(uerr.Body))
+		}
+		if called {
+			t.Error("Should not stream")
+		}
+		if !recorder.closed {
+			t.Error("Should be closed")
+		}
+	})
+
+	t.Run("Problem", func(t *testing.T) {
+		handler := &StreamingResponseHandler{}
+		handler.ExpectSuccessful()
+
+		res, _ := newResponse(404, "application/problem+json", strings.NewReader(`{"title":"Not Found"}`))
+		err := handler.HandleResponse(res)
+		var problem *ProblemError
+		if !errors.As(err, &problem) || problem.Title != "Not Found" {
+			t.Errorf("Should be ProblemError, but got: %v", err)
+		}
+	})
+
+	t.Run("OnStatus", func(t *testing.T) {
+		called := false
+		handler := &StreamingResponseHandler{
+			Stream: func(body io.Reader) error {
+				called = true
+				return nil
+			},
+		}
+		handler.ExpectSuccessful()
+		handler.OnStatus(404, func(res *http.Response) error {
+			_, err := ioutil.ReadAll(res.Body)
+			return err
+		})
+
+		res, recorder := newResponse(404, "text/plain", strings.NewReader("not found"))
+		if err := handler.HandleResponse(res); err != nil {
+			t.Fatal(err)
+		}
+		if called {
+			t.Error("Should not stream")
+		}
+		if !recorder.closed {
+			t.Error("Should be closed")
+		}
+	})
+}
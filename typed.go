@@ -0,0 +1,78 @@
+package httpflow
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+)
+
+// TypedSession is a session which provides its typed result after it has been run.
+type TypedSession[T any] interface {
+	Session
+	Result() (T, error)
+}
+
+// TypedJSONResponseHandler decodes the JSON body into T once in HandleResponse and caches it.
+// The result is the zero value if the response is handled by the callback set by OnStatus.
+type TypedJSONResponseHandler[T any] struct {
+	JSONResponseHandler
+	result T
+	err    error
+}
+
+var _ ResponseHandler = &TypedJSONResponseHandler[interface{}]{}
+
+func (h *TypedJSONResponseHandler[T]) HandleResponse(res *http.Response) error {
+	var zero T
+	h.result, h.err = zero, nil
+
+	if err := h.JSONResponseHandler.HandleResponse(res); err != nil {
+		h.err = err
+		return err
+	}
+	if h.StatusHandled() {
+		return nil
+	}
+
+	h.err = h.DecodeJSON(&h.result)
+	return h.err
+}
+
+func (h *TypedJSONResponseHandler[T]) Result() (T, error) {
+	return h.result, h.err
+}
+
+type JSONSession[Req, Res any] struct {
+	RequestMethod string
+	RequestHeader http.Header
+	RequestURL    *url.URL
+	// RequestBody is sent as JSON unless it is nil.
+	RequestBody *Req
+	TypedJSONResponseHandler[Res]
+}
+
+var _ TypedSession[interface{}] = &JSONSession[interface{}, interface{}]{}
+
+func (s *JSONSession[Req, Res]) BuildRequest() (*http.Request, error) {
+	var body interface{}
+	if s.RequestBody != nil {
+		body = s.RequestBody
+	}
+
+	builder := &JSONRequestBuilder{
+		RequestMethod: s.RequestMethod,
+		RequestHeader: s.RequestHeader,
+		RequestURL:    s.RequestURL,
+		RequestBody:   body,
+	}
+	return builder.BuildRequest()
+}
+
+// RunTypedSession runs the session by the agent and returns its typed result.
+func RunTypedSession[T any](ctx context.Context, agent *Agent, session TypedSession[T]) (T, error) {
+	if err := agent.RunSessionCtx(ctx, session); err != nil {
+		var zero T
+		return zero, err
+	}
+	return session.Result()
+}
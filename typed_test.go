@@ -0,0 +1,145 @@
+package httpflow
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+type mockUser struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func TestTypedJSONResponseHandler(t *testing.T) {
+	t.Run("JSON", func(t *testing.T) {
+		handler := &TypedJSONResponseHandler[mockUser]{}
+		res := mockResponse{200, map[string]string{"Content-Type": "application/json"}, []byte(`{"id":1,"name":"karupa"}`)}.MockResponse(nil)
+		if err := handler.HandleResponse(res); err != nil {
+			t.Fatal(err)
+		}
+
+		user, err := handler.Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(user, mockUser{ID: 1, Name: "karupa"}); diff != "" {
+			t.Errorf("Should no diff, but got: %s", diff)
+		}
+	})
+
+	t.Run("Not JSON", func(t *testing.T) {
+		handler := &TypedJSONResponseHandler[mockUser]{}
+		res := mockResponse{200, map[string]string{"Content-Type": "text/plain"}, []byte(`{"id":1}`)}.MockResponse(nil)
+		err := handler.HandleResponse(res)
+		if _, ok := err.(*UnexpectedContentTypeError); !ok {
+			t.Errorf("Should be UnexpectedContentTypeError, but got: %v", err)
+		}
+
+		user, rerr := handler.Result()
+		if rerr != err {
+			t.Errorf("Should be same error, but got: %v", rerr)
+		}
+		if user != (mockUser{}) {
+			t.Errorf("Should be zero value, but got: %+v", user)
+		}
+	})
+
+	t.Run("Unexpected Status Code", func(t *testing.T) {
+		handler := &TypedJSONResponseHandler[mockUser]{}
+		handler.ExpectStatusCode(200)
+		res := mockResponse{404, map[string]string{"Content-Type": "application/json"}, []byte(`{"id":1}`)}.MockResponse(nil)
+		err := handler.HandleResponse(res)
+		if _, ok := err.(*UnexpectedStatusCodeError); !ok {
+			t.Errorf("Should be UnexpectedStatusCodeError, but got: %v", err)
+		}
+		if _, rerr := handler.Result(); rerr != err {
+			t.Errorf("Should be same error, but got: %v", rerr)
+		}
+	})
+
+	t.Run("OnStatus", func(t *testing.T) {
+		handler := &TypedJSONResponseHandler[*mockUser]{}
+		handler.ExpectSuccessful()
+		handler.OnStatus(404, func(*http.Response) error { return nil })
+		res := mockResponse{404, map[string]string{"Content-Type": "text/html"}, []byte(`<html></html>`)}.MockResponse(nil)
+		if err := handler.HandleResponse(res); err != nil {
+			t.Fatal(err)
+		}
+
+		user, err := handler.Result()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user != nil {
+			t.Errorf("Should be nil, but got: %+v", user)
+		}
+	})
+}
+
+func TestJSONSession(t *testing.T) {
+	t.Run("BuildRequest", func(t *testing.T) {
+		session := &JSONSession[mockUser, mockUser]{
+			RequestMethod: http.MethodPost,
+			RequestURL:    mustParseURL("http://example.com/users"),
+			RequestBody:   &mockUser{Name: "karupa"},
+		}
+		req, err := session.BuildRequest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := req.Header.Get("Content-Type"); s != "application/json" {
+			t.Errorf("Should be application/json, but got: %s", s)
+		}
+		if body, err := ioutil.ReadAll(req.Body); string(body) != `{"id":0,"name":"karupa"}` || err != nil {
+			t.Errorf("Should be {\"id\":0,\"name\":\"karupa\"}, but got: %s, error: %v", string(body), err)
+		}
+
+		session.RequestBody = nil
+		req, err = session.BuildRequest()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.Body != nil && req.Body != http.NoBody {
+			t.Errorf("Should have no body, but got: %v", req.Body)
+		}
+	})
+
+	t.Run("RunTypedSession", func(t *testing.T) {
+		agent := &Agent{Client: mockClient{mockResponse: mockResponse{200, map[string]string{"Content-Type": "application/json"}, []byte(`{"id":1,"name":"karupa"}`)}}}
+		session := &JSONSession[struct{}, mockUser]{
+			RequestMethod: http.MethodGet,
+			RequestURL:    mustParseURL("http://example.com/users/1"),
+		}
+
+		user, err := RunTypedSession[mockUser](context.Background(), agent, session)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := cmp.Diff(user, mockUser{ID: 1, Name: "karupa"}); diff != "" {
+			t.Errorf("Should no diff, but got: %s", diff)
+		}
+	})
+
+	t.Run("RunTypedSession Error", func(t *testing.T) {
+		agent := &Agent{Client: mockClient{mockResponse: mockResponse{500, map[string]string{"Content-Type": "application/json"}, []byte(`{"id":1}`)}}}
+		session := &JSONSession[struct{}, mockUser]{
+			RequestMethod: http.MethodGet,
+			RequestURL:    mustParseURL("http://example.com/users/1"),
+		}
+		session.ExpectStatusCode(200)
+
+		user, err := RunTypedSession[mockUser](context.Background(), agent, session)
+		var uerr *UnexpectedStatusCodeError
+		if !errors.As(err, &uerr) {
+			t.Errorf("Should be UnexpectedStatusCodeError, but got: %v", err)
+		}
+		if user != (mockUser{}) {
+			t.Errorf("Should be zero value, but got: %+v", user)
+		}
+	})
+}
@@ -0,0 +1,399 @@
+package httpflow
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+type uriTemplateOperator struct {
+	first         string
+	sep           string
+	named         bool
+	ifEmpty       string
+	allowReserved bool
+}
+
+var uriTemplateOperators = map[byte]uriTemplateOperator{
+	'+': {first: "", sep: ",", allowReserved: true},
+	'.': {first: ".", sep: "."},
+	'/': {first: "/", sep: "/"},
+	';': {first: ";", sep: ";", named: true},
+	'?': {first: "?", sep: "&", named: true, ifEmpty: "="},
+	'&': {first: "&", sep: "&", named: true, ifEmpty: "="},
+	'#': {first: "#", sep: ",", allowReserved: true},
+}
+
+var defaultURITemplateOperator = uriTemplateOperator{first: "", sep: ","}
+
+type uriTemplateVarSpec struct {
+	name      string
+	maxLength int
+	explode   bool
+}
+
+// ExpandURITemplate expands the URI template by RFC 6570 (up to level 4).
+// vars should be a map with string keys or a struct. The names of the struct fields can be
+// changed by `uri:"name"` tag, and the fields tagged with `uri:"-"` are ignored.
+// Slices and arrays are expanded as lists, and maps are expanded as associative arrays.
+func ExpandURITemplate(template string, vars interface{}) (string, error) {
+	values, err := uriTemplateVariables(vars)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	for len(template) > 0 {
+		start := strings.IndexAny(template, "{}")
+		if start == -1 {
+			b.WriteString(encodeURITemplateString(template, true))
+			break
+		}
+		if template[start] == '}' {
+			return "", fmt.Errorf("unexpected '}' in URI template at: %q", template[start:])
+		}
+
+		end := strings.IndexByte(template[start:], '}')
+		if end == -1 {
+			return "", fmt.Errorf("unclosed expression in URI template: %q", template[start:])
+		}
+		end += start
+
+		b.WriteString(encodeURITemplateString(template[:start], true))
+		if err := expandURITemplateExpression(&b, template[start+1:end], values); err != nil {
+			return "", err
+		}
+		template = template[end+1:]
+	}
+	return b.String(), nil
+}
+
+func expandURITemplateExpression(b *strings.Builder, expression string, values map[string]interface{}) error {
+	op := defaultURITemplateOperator
+	if expression != "" {
+		if o, ok := uriTemplateOperators[expression[0]]; ok {
+			op = o
+			expression = expression[1:]
+		} else if strings.IndexByte("=,!@|", expression[0]) != -1 {
+			return fmt.Errorf("reserved operator in URI template: %q", expression[0])
+		}
+	}
+
+	first := true
+	for _, spec := range strings.Split(expression, ",") {
+		varSpec, err := parseURITemplateVarSpec(spec)
+		if err != nil {
+			return err
+		}
+
+		value, ok := values[varSpec.name]
+		if !ok {
+			continue
+		}
+		expanded, ok, err := expandURITemplateVariable(op, varSpec, value)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			continue
+		}
+
+		if first {
+			b.WriteString(op.first)
+			first = false
+		} else {
+			b.WriteString(op.sep)
+		}
+		b.WriteString(expanded)
+	}
+	return nil
+}
+
+func parseURITemplateVarSpec(spec string) (uriTemplateVarSpec, error) {
+	varSpec := uriTemplateVarSpec{name: spec}
+	if strings.HasSuffix(spec, "*") {
+		varSpec.name = spec[:len(spec)-1]
+		varSpec.explode = true
+	} else if i := strings.IndexByte(spec, ':'); i != -1 {
+		varSpec.name = spec[:i]
+		maxLength := 0
+		for _, c := range spec[i+1:] {
+			if c < '0' || '9' < c {
+				return varSpec, fmt.Errorf("invalid prefix modifier in URI template: %q", spec)
+			}
+			maxLength = maxLength*10 + int(c-'0')
+		}
+		if maxLength <= 0 || 10000 <= maxLength || spec[i+1] == '0' {
+			return varSpec, fmt.Errorf("invalid prefix modifier in URI template: %q", spec)
+		}
+		varSpec.maxLength = maxLength
+	}
+
+	if !isValidURITemplateVarName(varSpec.name) {
+		return varSpec, fmt.Errorf("invalid variable name in URI template: %q", spec)
+	}
+	return varSpec, nil
+}
+
+func isValidURITemplateVarName(name string) bool {
+	if name == "" || name[0] == '.' || name[len(name)-1] == '.' {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9', c == '_':
+		case c == '.':
+			if name[i-1] == '.' {
+				return false
+			}
+		case c == '%':
+			if i+2 >= len(name) || !isHex(name[i+1]) || !isHex(name[i+2]) {
+				return false
+			}
+			i += 2
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func expandURITemplateVariable(op uriTemplateOperator, spec uriTemplateVarSpec, value interface{}) (string, bool, error) {
+	str, list, pairs, ok := uriTemplateValue(value)
+	if !ok {
+		return "", false, nil
+	}
+
+	var b strings.Builder
+	if list == nil && pairs == nil {
+		if op.named {
+			b.WriteString(spec.name)
+			if str == "" {
+				b.WriteString(op.ifEmpty)
+				return b.String(), true, nil
+			}
+			b.WriteByte('=')
+		}
+		if spec.maxLength > 0 && utf8.RuneCountInString(str) > spec.maxLength {
+			str = string([]rune(str)[:spec.maxLength])
+		}
+		b.WriteString(encodeURITemplateString(str, op.allowReserved))
+		return b.String(), true, nil
+	}
+
+	if spec.maxLength > 0 {
+		return "", false, fmt.Errorf("prefix modifier is not applicable to composite value: %q", spec.name)
+	}
+
+	if !spec.explode {
+		if op.named {
+			b.WriteString(spec.name)
+			b.WriteByte('=')
+		}
+		if list != nil {
+			for i, item := range list {
+				if i != 0 {
+					b.WriteByte(',')
+				}
+				b.WriteString(encodeURITemplateString(item, op.allowReserved))
+			}
+		} else {
+			for i, pair := range pairs {
+				if i != 0 {
+					b.WriteByte(',')
+				}
+				b.WriteString(encodeURITemplateString(pair[0], op.allowReserved))
+				b.WriteByte(',')
+				b.WriteString(encodeURITemplateString(pair[1], op.allowReserved))
+			}
+		}
+		return b.String(), true, nil
+	}
+
+	writeNamed := func(name, value string) {
+		b.WriteString(encodeURITemplateString(name, op.allowReserved))
+		if value == "" {
+			b.WriteString(op.ifEmpty)
+			return
+		}
+		b.WriteByte('=')
+		b.WriteString(encodeURITemplateString(value, op.allowReserved))
+	}
+	if list != nil {
+		for i, item := range list {
+			if i != 0 {
+				b.WriteString(op.sep)
+			}
+			if op.named {
+				writeNamed(spec.name, item)
+			} else {
+				b.WriteString(encodeURITemplateString(item, op.allowReserved))
+			}
+		}
+	} else {
+		for i, pair := range pairs {
+			if i != 0 {
+				b.WriteString(op.sep)
+			}
+			if op.named {
+				writeNamed(pair[0], pair[1])
+			} else {
+				b.WriteString(encodeURITemplateString(pair[0], op.allowReserved))
+				b.WriteByte('=')
+				b.WriteString(encodeURITemplateString(pair[1], op.allowReserved))
+			}
+		}
+	}
+	return b.String(), true, nil
+}
+
+// uriTemplateValue converts the value to a string, a list or an associative array.
+// ok is false if the value is undefined.
+func uriTemplateValue(value interface{}) (str string, list []string, pairs [][2]string, ok bool) {
+	v := reflect.ValueOf(value)
+	for v.IsValid() && (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) {
+		if v.IsNil() {
+			return "", nil, nil, false
+		}
+		if _, isStringer := v.Interface().(fmt.Stringer); isStringer {
+			break
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return "", nil, nil, false
+	}
+	if stringer, isStringer := v.Interface().(fmt.Stringer); isStringer {
+		return stringer.String(), nil, nil, true
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), nil, nil, true
+		}
+		if v.Len() == 0 {
+			return "", nil, nil, false
+		}
+		list = make([]string, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if item, _, _, ok := uriTemplateValue(v.Index(i).Interface()); ok {
+				list = append(list, item)
+			}
+		}
+		return "", list, nil, len(list) != 0
+	case reflect.Map:
+		if v.Len() == 0 {
+			return "", nil, nil, false
+		}
+		pairs = make([][2]string, 0, v.Len())
+		for _, key := range v.MapKeys() {
+			if item, _, _, ok := uriTemplateValue(v.MapIndex(key).Interface()); ok {
+				pairs = append(pairs, [2]string{fmt.Sprint(key.Interface()), item})
+			}
+		}
+		sort.Slice(pairs, func(i, j int) bool { return pairs[i][0] < pairs[j][0] })
+		return "", nil, pairs, len(pairs) != 0
+	default:
+		return fmt.Sprint(v.Interface()), nil, nil, true
+	}
+}
+
+func uriTemplateVariables(vars interface{}) (map[string]interface{}, error) {
+	values := map[string]interface{}{}
+	v := reflect.ValueOf(vars)
+	for v.IsValid() && v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			return values, nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() {
+		return values, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("URI template variables should have string keys, but got: %s", v.Type())
+		}
+		for _, key := range v.MapKeys() {
+			values[key.String()] = v.MapIndex(key).Interface()
+		}
+	case reflect.Struct:
+		collectURITemplateFields(values, v)
+	default:
+		return nil, fmt.Errorf("URI template variables should be a map or a struct, but got: %s", v.Type())
+	}
+	return values, nil
+}
+
+func collectURITemplateFields(values map[string]interface{}, v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := field.Tag.Get("uri")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			fv := v.Field(i)
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			if fv.Kind() == reflect.Struct {
+				collectURITemplateFields(values, fv)
+				continue
+			}
+		}
+		if field.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		values[name] = v.Field(i).Interface()
+	}
+}
+
+const upperHex = "0123456789ABCDEF"
+
+func isHex(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func isURIUnreserved(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9') ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
+
+func isURIReserved(c byte) bool {
+	return strings.IndexByte(":/?#[]@!$&'()*+,;=", c) != -1
+}
+
+func encodeURITemplateString(s string, allowReserved bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case isURIUnreserved(c):
+			b.WriteByte(c)
+		case allowReserved && isURIReserved(c):
+			b.WriteByte(c)
+		case allowReserved && c == '%' && i+2 < len(s) && isHex(s[i+1]) && isHex(s[i+2]):
+			b.WriteString(s[i : i+3])
+			i += 2
+		default:
+			b.WriteByte('%')
+			b.WriteByte(upperHex[c>>4])
+			b.WriteByte(upperHex[c&15])
+		}
+	}
+	return b.String()
+}
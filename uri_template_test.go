@@ -0,0 +1,232 @@
+package httpflow
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestExpandURITemplate(t *testing.T) {
+	// examples from RFC 6570
+	vars := map[string]interface{}{
+		"count":      []string{"one", "two", "three"},
+		"dom":        []string{"example", "com"},
+		"dub":        "me/too",
+		"hello":      "Hello World!",
+		"half":       "50%",
+		"var":        "value",
+		"who":        "fred",
+		"base":       "http://example.com/home/",
+		"path":       "/foo/bar",
+		"list":       []string{"red", "green", "blue"},
+		"keys":       map[string]string{"semi": ";", "dot": ".", "comma": ","},
+		"v":          6,
+		"x":          1024,
+		"y":          768,
+		"empty":      "",
+		"empty_keys": map[string]string{},
+		"undef":      nil,
+	}
+
+	for template, expected := range map[string]string{
+		// Level 1
+		"{var}":   "value",
+		"{hello}": "Hello%20World%21",
+		// Level 2
+		"{+var}":           "value",
+		"{+hello}":         "Hello%20World!",
+		"{+path}/here":     "/foo/bar/here",
+		"here?ref={+path}": "here?ref=/foo/bar",
+		"X{#var}":          "X#value",
+		"X{#hello}":        "X#Hello%20World!",
+		"{+half}":          "50%25",
+		// Level 3
+		"map?{x,y}":           "map?1024,768",
+		"{x,hello,y}":         "1024,Hello%20World%21,768",
+		"{+x,hello,y}":        "1024,Hello%20World!,768",
+		"{+path,x}/here":      "/foo/bar,1024/here",
+		"{#x,hello,y}":        "#1024,Hello%20World!,768",
+		"{#path,x}/here":      "#/foo/bar,1024/here",
+		"X{.var}":             "X.value",
+		"X{.x,y}":             "X.1024.768",
+		"{/var}":              "/value",
+		"{/var,x}/here":       "/value/1024/here",
+		"{;x,y}":              ";x=1024;y=768",
+		"{;x,y,empty}":        ";x=1024;y=768;empty",
+		"{?x,y}":              "?x=1024&y=768",
+		"{?x,y,empty}":        "?x=1024&y=768&empty=",
+		"?fixed=yes{&x}":      "?fixed=yes&x=1024",
+		"{&x,y,empty}":        "&x=1024&y=768&empty=",
+		"{var:3}":             "val",
+		"{var:30}":            "value",
+		"{list}":              "red,green,blue",
+		"{list*}":             "red,green,blue",
+		"{keys}":              "comma,%2C,dot,.,semi,%3B",
+		"{keys*}":             "comma=%2C,dot=.,semi=%3B",
+		"{+path:6}/here":      "/foo/b/here",
+		"{+list}":             "red,green,blue",
+		"{+list*}":            "red,green,blue",
+		"{+keys}":             "comma,,,dot,.,semi,;",
+		"{+keys*}":            "comma=,,dot=.,semi=;",
+		"{#path:6}/here":      "#/foo/b/here",
+		"{#list}":             "#red,green,blue",
+		"{#list*}":            "#red,green,blue",
+		"{#keys}":             "#comma,,,dot,.,semi,;",
+		"{#keys*}":            "#comma=,,dot=.,semi=;",
+		"X{.var:3}":           "X.val",
+		"X{.list}":            "X.red,green,blue",
+		"X{.list*}":           "X.red.green.blue",
+		"X{.keys}":            "X.comma,%2C,dot,.,semi,%3B",
+		"X{.keys*}":           "X.comma=%2C.dot=..semi=%3B",
+		"{/var:1,var}":        "/v/value",
+		"{/list}":             "/red,green,blue",
+		"{/list*}":            "/red/green/blue",
+		"{/list*,path:4}":     "/red/green/blue/%2Ffoo",
+		"{/keys}":             "/comma,%2C,dot,.,semi,%3B",
+		"{/keys*}":            "/comma=%2C/dot=./semi=%3B",
+		"{;hello:5}":          ";hello=Hello",
+		"{;list}":             ";list=red,green,blue",
+		"{;list*}":            ";list=red;list=green;list=blue",
+		"{;keys}":             ";keys=comma,%2C,dot,.,semi,%3B",
+		"{;keys*}":            ";comma=%2C;dot=.;semi=%3B",
+		"{?var:3}":            "?var=val",
+		"{?list}":             "?list=red,green,blue",
+		"{?list*}":            "?list=red&list=green&list=blue",
+		"{?keys}":             "?keys=comma,%2C,dot,.,semi,%3B",
+		"{?keys*}":            "?comma=%2C&dot=.&semi=%3B",
+		"{&var:3}":            "&var=val",
+		"{&list}":             "&list=red,green,blue",
+		"{&list*}":            "&list=red&list=green&list=blue",
+		"{&keys}":             "&keys=comma,%2C,dot,.,semi,%3B",
+		"{&keys*}":            "&comma=%2C&dot=.&semi=%3B",
+		"{count}":             "one,two,three",
+		"{count*}":            "one,two,three",
+		"{/count}":            "/one,two,three",
+		"{/count*}":           "/one/two/three",
+		"{;count}":            ";count=one,two,three",
+		"{;count*}":           ";count=one;count=two;count=three",
+		"{?count}":            "?count=one,two,three",
+		"{?count*}":           "?count=one&count=two&count=three",
+		"{&count*}":           "&count=one&count=two&count=three",
+		"{who}":               "fred",
+		"{dub}":               "me%2Ftoo",
+		"{.who}":              ".fred",
+		"{.who,who}":          ".fred.fred",
+		"www{.dom*}":          "www.example.com",
+		"{base}index":         "http%3A%2F%2Fexample.com%2Fhome%2Findex",
+		"{+base}index":        "http://example.com/home/index",
+		"{/who,dub}":          "/fred/me%2Ftoo",
+		"{?undef,empty_keys}": "",
+		"{?v,undef,who}":      "?v=6&who=fred",
+		"O{empty}X":           "OX",
+		"O{undef}X":           "OX",
+		"{x,undef}":           "1024",
+		"literal with space":  "literal%20with%20space",
+	} {
+		actual, err := ExpandURITemplate(template, vars)
+		if err != nil {
+			t.Errorf("%s: %v", template, err)
+			continue
+		}
+		if actual != expected {
+			t.Errorf("%s: Should be %s, but got: %s", template, expected, actual)
+		}
+	}
+}
+
+func TestExpandURITemplateError(t *testing.T) {
+	for _, template := range []string{
+		"{var",
+		"var}",
+		"{va r}",
+		"{var:0}",
+		"{var:10000}",
+		"{var:x}",
+		"{=var}",
+		"{list:3}",
+		"{.var.}",
+	} {
+		if _, err := ExpandURITemplate(template, map[string]interface{}{"var": "value", "list": []int{1}}); err == nil {
+			t.Errorf("%s: Should not be nil", template)
+		}
+	}
+
+	if _, err := ExpandURITemplate("{var}", 1); err == nil {
+		t.Error("Should not be nil")
+	}
+	if _, err := ExpandURITemplate("{var}", map[int]string{}); err == nil {
+		t.Error("Should not be nil")
+	}
+}
+
+func TestExpandURITemplateStruct(t *testing.T) {
+	type Paging struct {
+		Page    *int `uri:"page"`
+		PerPage int  `uri:"per_page"`
+	}
+	page := 2
+	vars := &struct {
+		Paging
+		ID      int      `uri:"id"`
+		Tags    []string `uri:"tags"`
+		Name    string
+		Ignored string `uri:"-"`
+		private string
+	}{
+		Paging:  Paging{Page: &page, PerPage: 10},
+		ID:      1,
+		Tags:    []string{"a b", "c"},
+		Name:    "karupa",
+		Ignored: "ignored",
+		private: "private",
+	}
+
+	actual, err := ExpandURITemplate("/users/{id}{?page,per_page,tags*,Name,Ignored,private}", vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "/users/1?page=2&per_page=10&tags=a%20b&tags=c&Name=karupa"; actual != expected {
+		t.Errorf("Should be %s, but got: %s", expected, actual)
+	}
+
+	vars.Page = nil
+	actual, err = ExpandURITemplate("{?page,per_page}", vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "?per_page=10"; actual != expected {
+		t.Errorf("Should be %s, but got: %s", expected, actual)
+	}
+}
+
+func TestRequestBuilderURITemplate(t *testing.T) {
+	const template = "http://localhost/users/{id}{?fields*}"
+	vars := map[string]interface{}{"id": "a/b", "fields": []string{"id", "name"}}
+	const expected = "http://localhost/users/a%2Fb?fields=id&fields=name"
+
+	for name, builder := range map[string]RequestBuilder{
+		"Nobody": &NobodyRequestBuilder{RequestMethod: http.MethodGet, RequestURLTemplate: template, RequestURLVariables: vars},
+		"Form":   &FormRequestBuilder{RequestMethod: http.MethodGet, RequestURLTemplate: template, RequestURLVariables: vars},
+		"JSON":   &JSONRequestBuilder{RequestMethod: http.MethodGet, RequestURLTemplate: template, RequestURLVariables: vars},
+	} {
+		t.Run(name, func(t *testing.T) {
+			req, err := builder.BuildRequest()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s := req.URL.String(); s != expected {
+				t.Errorf("Should be %s, but got: %s", expected, s)
+			}
+		})
+	}
+
+	t.Run("Error", func(t *testing.T) {
+		builder := &NobodyRequestBuilder{RequestMethod: http.MethodGet, RequestURLTemplate: "http://localhost/{id"}
+		req, err := builder.BuildRequest()
+		if req != nil {
+			t.Errorf("Should be nil, but got: %v", req)
+		}
+		if err == nil {
+			t.Fatal("Should not be nil")
+		}
+	})
+}